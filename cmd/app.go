@@ -1,15 +1,28 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"mess/pkg/app"
 	"mess/pkg/config"
 )
 
+var (
+	appLocked     bool
+	appJobs       int
+	appSequential bool
+	appKeepGoing  bool
+)
+
 // appCmd represents the app command
 var appCmd = &cobra.Command{
 	Use:     "app",
@@ -19,9 +32,14 @@ var appCmd = &cobra.Command{
 Usage patterns:
   mess app <application-name> init                          - Create a new application
   mess app <application-name> link <repo-name> [...repo-name] - Link repositories to application  
-  mess app <application-name> setup                        - Setup application (clone repos, create symlinks, run setup scripts)
-  mess app <application-name> clone                        - Clone application repositories and create symlinks
-  mess app <application-name> run <script-name>            - Run a script for the application`,
+  mess app <application-name> setup [--locked] [--jobs N]  - Setup application (clone repos, create symlinks, run setup scripts)
+  mess app <application-name> clone [--locked] [--jobs N]  - Clone application repositories and create symlinks
+  mess app <application-name> run <script-name> [--sequential] [--keep-going] [-- args...]
+                                                           - Run a script for the application, passing it args
+  mess app <application-name> up [service-name...]         - Start services in the background
+  mess app <application-name> down [service-name...]       - Stop running services
+  mess app <application-name> restart [service-name...]    - Restart services
+  mess app <application-name> ps                           - Show the status of services`,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(args) < 2 {
@@ -31,7 +49,16 @@ Usage patterns:
 			fmt.Println("  mess app <application-name> link <repo-name> [...repo-name]")
 			fmt.Println("  mess app <application-name> setup")
 			fmt.Println("  mess app <application-name> clone")
-			fmt.Println("  mess app <application-name> run <script-name>")
+			fmt.Println("  mess app <application-name> run <script-name> [-- args...]")
+			fmt.Println("  mess app <application-name> up|down|restart [service-name...]")
+			fmt.Println("  mess app <application-name> ps")
+			os.Exit(1)
+		}
+
+		// Arguments after "--" are passed to the script by 'run'
+		args, extraArgs, err := splitAppArgs(args, cmd.ArgsLenAtDash())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
 
@@ -49,15 +76,36 @@ Usage patterns:
 		case "clone":
 			handleAppClone(appName, remainingArgs)
 		case "run":
-			handleAppRun(appName, remainingArgs)
+			handleAppRun(appName, remainingArgs, extraArgs)
+		case "up", "down", "restart":
+			handleAppServices(appName, subCommand, remainingArgs)
+		case "ps":
+			handleAppPs(appName, remainingArgs)
 		default:
 			fmt.Printf("Error: unknown subcommand '%s'\n", subCommand)
-			fmt.Println("Available subcommands: init, link, setup, clone, run")
+			fmt.Println("Available subcommands: init, link, setup, clone, run, up, down, restart, ps")
 			os.Exit(1)
 		}
 	},
 }
 
+// splitAppArgs splits the arguments of 'mess app' at "--", which is at position dash or -1:
+// the application name, subcommand and their arguments, and the arguments for the script,
+// which only 'run' takes
+func splitAppArgs(args []string, dash int) ([]string, []string, error) {
+	if dash < 0 {
+		return args, nil, nil
+	}
+	if dash < 2 {
+		return nil, nil, fmt.Errorf("'--' must follow the application name and subcommand")
+	}
+	extraArgs := args[dash:]
+	if len(extraArgs) > 0 && args[1] != "run" {
+		return nil, nil, fmt.Errorf("'app %s %s' does not take arguments after '--'", args[0], args[1])
+	}
+	return args[:dash], extraArgs, nil
+}
+
 // handleAppInit handles the app <application-name> init command
 func handleAppInit(appName string, args []string) {
 	if len(args) > 0 {
@@ -205,11 +253,9 @@ func handleAppSetup(appName string, args []string) {
 	}
 
 	// Load existing configuration
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
-	}
+	cfg := loadResolvedConfig()
+
+	useGitBackend(cfg)
 
 	// Find application
 	var targetApp *config.ApplicationDefinition
@@ -235,8 +281,17 @@ func handleAppSetup(appName string, args []string) {
 		configPath = "mess.json"
 	}
 
+	// Pin repositories to the locked commits
+	if appLocked {
+		applyLock(cfg, configPath)
+	}
+
+	// Abort running clones on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Setup application
-	if err := app.SetupApplication(targetApp, cfg, configPath); err != nil {
+	if err := app.SetupApplication(ctx, targetApp, cfg, configPath, appJobs, appLocked); err != nil {
 		fmt.Printf("Error setting up application: %v\n", err)
 		os.Exit(1)
 	}
@@ -252,11 +307,9 @@ func handleAppClone(appName string, args []string) {
 	}
 
 	// Load existing configuration
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
-	}
+	cfg := loadResolvedConfig()
+
+	useGitBackend(cfg)
 
 	// Find application
 	var targetApp *config.ApplicationDefinition
@@ -282,8 +335,17 @@ func handleAppClone(appName string, args []string) {
 		configPath = "mess.json"
 	}
 
+	// Pin repositories to the locked commits
+	if appLocked {
+		applyLock(cfg, configPath)
+	}
+
+	// Abort running clones on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Clone application repositories
-	if err := app.CloneApplication(targetApp, cfg, configPath); err != nil {
+	if err := app.CloneApplication(ctx, targetApp, cfg, configPath, appJobs, appLocked); err != nil {
 		fmt.Printf("Error cloning application: %v\n", err)
 		os.Exit(1)
 	}
@@ -291,22 +353,18 @@ func handleAppClone(appName string, args []string) {
 	fmt.Printf("Successfully cloned application '%s'\n", appName)
 }
 
-// handleAppRun handles the app <application-name> run <script-name> command
-func handleAppRun(appName string, args []string) {
+// handleAppRun handles the app <application-name> run <script-name> [-- args...] command
+func handleAppRun(appName string, args []string, scriptArgs []string) {
 	if len(args) != 1 {
 		fmt.Printf("Error: 'app %s run' requires exactly one script name\n", appName)
-		fmt.Printf("Usage: mess app %s run <script-name>\n", appName)
+		fmt.Printf("Usage: mess app %s run <script-name> [-- args...]\n", appName)
 		os.Exit(1)
 	}
 
 	scriptName := args[0]
 
 	// Load existing configuration
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
-	}
+	cfg := loadResolvedConfig()
 
 	// Find application
 	var targetApp *config.ApplicationDefinition
@@ -343,8 +401,13 @@ func handleAppRun(appName string, args []string) {
 		configPath = "mess.json"
 	}
 
+	// Stop the script and any long-running scripts it depends on on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Run script
-	if err := app.RunScript(targetApp, scriptName, &scriptValue, configPath); err != nil {
+	opts := app.RunOptions{Sequential: appSequential, KeepGoing: appKeepGoing, Args: scriptArgs}
+	if err := app.RunScript(ctx, targetApp, scriptName, &scriptValue, configPath, opts); err != nil {
 		fmt.Printf("Error running script: %v\n", err)
 		os.Exit(1)
 	}
@@ -352,6 +415,101 @@ func handleAppRun(appName string, args []string) {
 	fmt.Printf("Successfully executed script '%s' for application '%s'\n", scriptName, appName)
 }
 
+// findApplication loads the configuration and returns the named application, exiting if it does not exist
+func findApplication(appName string) *config.ApplicationDefinition {
+	cfg := loadResolvedConfig()
+
+	for _, app := range cfg.Applications {
+		if app.Name == appName {
+			return &app
+		}
+	}
+
+	fmt.Printf("Application '%s' not found\n", appName)
+	fmt.Printf("Available applications:\n")
+	for _, app := range cfg.Applications {
+		fmt.Printf("  - %s\n", app.Name)
+	}
+	os.Exit(1)
+	return nil
+}
+
+// handleAppServices handles the app <application-name> up|down|restart [service-name...] commands
+func handleAppServices(appName, action string, args []string) {
+	targetApp := findApplication(appName)
+
+	// Get config file directory
+	configPath := configFile
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+
+	var err error
+	switch action {
+	case "up":
+		err = app.StartServices(targetApp, configPath, args)
+	case "down":
+		err = app.StopServices(targetApp, configPath, args)
+	case "restart":
+		err = app.StopServices(targetApp, configPath, args)
+		if err == nil {
+			err = app.StartServices(targetApp, configPath, args)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// handleAppPs handles the app <application-name> ps command
+func handleAppPs(appName string, args []string) {
+	if len(args) > 0 {
+		fmt.Printf("Error: 'app %s ps' takes no additional arguments\n", appName)
+		os.Exit(1)
+	}
+
+	targetApp := findApplication(appName)
+
+	// Get config file directory
+	configPath := configFile
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+
+	states, err := app.ServiceStatuses(targetApp, configPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(states) == 0 {
+		fmt.Printf("Application '%s' has no services\n", appName)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tSTATUS\tPID\tRESTARTS\tUPTIME\tLOG")
+	for _, state := range states {
+		pid, uptime, logFile := "-", "-", "-"
+		status := state.Status
+		if state.Active() {
+			pid = strconv.Itoa(state.ChildPID)
+			uptime = time.Since(state.StartedAt).Round(time.Second).String()
+		} else if state.ExitCode != nil {
+			status = fmt.Sprintf("%s (%d)", status, *state.ExitCode)
+		}
+		if state.LogFile != "" {
+			logFile = state.LogFile
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", state.Service, status, pid, state.Restarts, uptime, logFile)
+	}
+	w.Flush()
+}
+
 func init() {
 	rootCmd.AddCommand(appCmd)
+	appCmd.Flags().IntVarP(&appJobs, "jobs", "j", 4, "maximum number of repositories to clone at once (setup, clone)")
+	appCmd.Flags().BoolVar(&appSequential, "sequential", false, "run array scripts one command at a time, stopping at the first failure (run)")
+	appCmd.Flags().BoolVar(&appKeepGoing, "keep-going", false, "keep running the remaining commands of a sequential script after a failure (run)")
+	appCmd.Flags().BoolVar(&appLocked, "locked", false, "check out the commits recorded in mess.lock when cloning (setup, clone)")
 } 
\ No newline at end of file
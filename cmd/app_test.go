@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAppArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		dash      int
+		wantArgs  []string
+		wantExtra []string
+		wantErr   string
+	}{
+		{name: "no dash", args: []string{"web", "run", "test"}, dash: -1, wantArgs: []string{"web", "run", "test"}},
+		{name: "run with arguments", args: []string{"web", "run", "test", "--watch", "a b"}, dash: 3, wantArgs: []string{"web", "run", "test"}, wantExtra: []string{"--watch", "a b"}},
+		{name: "dash without arguments", args: []string{"web", "setup"}, dash: 2, wantArgs: []string{"web", "setup"}, wantExtra: []string{}},
+		{name: "other subcommand with arguments", args: []string{"web", "setup", "--force"}, dash: 2, wantErr: "'app web setup' does not take arguments after '--'"},
+		{name: "dash before the subcommand", args: []string{"web", "run"}, dash: 1, wantErr: "'--' must follow the application name and subcommand"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, extra, err := splitAppArgs(tt.args, tt.dash)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("splitAppArgs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitAppArgs() error = %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) || !reflect.DeepEqual(extra, tt.wantExtra) {
+				t.Errorf("splitAppArgs() = %q, %q, want %q, %q", args, extra, tt.wantArgs, tt.wantExtra)
+			}
+		})
+	}
+}
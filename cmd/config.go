@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"mess/pkg/config"
+	"mess/pkg/output"
+)
+
+var (
+	convertFormat string
+	migrateWrite  bool
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Work with the mess.json file itself",
+	Long:  `Commands that operate on the configuration file rather than on repositories or applications.`,
+}
+
+// configConvertCmd represents the config convert command
+var configConvertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert the config file to JSON, YAML or TOML",
+	Long: `Rewrite the config file in another format next to it, e.g. mess.json as mess.yaml,
+and keep the original as mess.json.bak. The local override file (mess.local.json) is
+converted too. Comments are not carried over to the new file.`,
+	Example: `  mess config convert --to yaml`,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		newPath, err := config.ConvertConfig(configPath, strings.ToLower(convertFormat))
+		if err != nil {
+			fmt.Printf("Error converting config: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Successfully converted %s to %s\n", configPath, newPath)
+		fmt.Printf("The original files were kept with a .bak suffix, remove them once you no longer need them\n")
+	},
+}
+
+// configMigrateCmd represents the config migrate command
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the config file to the current config version",
+	Long: `Show the changes that upgrade the config file to the version used by this version
+of mess, and write them with --write. Older files are also upgraded in memory whenever
+they are loaded, so this is only needed to update the file itself. YAML and TOML
+files are rewritten without their comments.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		before, after, applied, err := config.MigrateConfig(configPath)
+		if err != nil {
+			fmt.Printf("Error migrating config: %v\n", err)
+			os.Exit(1)
+		}
+		if len(applied) == 0 {
+			fmt.Printf("%s is already at config version %d\n", configPath, config.CurrentVersion)
+			return
+		}
+
+		fmt.Println("Migrations:")
+		for _, step := range applied {
+			fmt.Printf("  %s\n", step)
+		}
+		fmt.Println()
+		fmt.Print(output.Diff(configPath, configPath, before, after))
+
+		if !migrateWrite {
+			fmt.Println()
+			fmt.Println("Run 'mess config migrate --write' to apply these changes")
+			return
+		}
+		if err := os.WriteFile(configPath, after, 0644); err != nil {
+			fmt.Printf("Error writing config file: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("\nSuccessfully migrated %s to config version %d\n", configPath, config.CurrentVersion)
+	},
+}
+
+// configSchemaCmd represents the config schema command
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long: `Print a JSON Schema describing the config file, for editors and other tools.
+Save it next to mess.json and refer to it with "$schema" to get autocompletion:
+
+  mess config schema > mess.schema.json
+
+  {
+    "$schema": "./mess.schema.json",
+    ...
+  }`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := json.MarshalIndent(config.Schema(), "", "  ")
+		if err != nil {
+			fmt.Printf("Error generating schema: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	configCmd.AddCommand(configConvertCmd)
+	configCmd.AddCommand(configMigrateCmd)
+
+	configMigrateCmd.Flags().BoolVar(&migrateWrite, "write", false, "write the upgraded config file instead of only showing the changes")
+
+	configConvertCmd.Flags().StringVar(&convertFormat, "to", "", "format to convert to: "+strings.Join(config.Formats, ", "))
+	configConvertCmd.MarkFlagRequired("to")
+}
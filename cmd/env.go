@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// envCmd represents the env command
+var envCmd = &cobra.Command{
+	Use:   "env <application-name>",
+	Short: "Print the environment of an application",
+	Long: `Print the environment variables mess sets for the commands of an application,
+in a form that can be evaluated by a POSIX shell:
+
+  eval "$(mess env web-app)"
+
+The output contains the MESS_* variables, the project env_files and env, and the
+application env_files and env, with variable references expanded. Variables of the
+environment mess runs in are not included.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg := loadResolvedConfig()
+
+		for _, app := range cfg.Applications {
+			if app.Name != args[0] {
+				continue
+			}
+
+			keys := make([]string, 0, len(app.Env))
+			for key := range app.Env {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				fmt.Printf("export %s='%s'\n", key, strings.ReplaceAll(app.Env[key], "'", `'\''`))
+			}
+			return
+		}
+
+		fmt.Printf("Application '%s' not found\n", args[0])
+		fmt.Printf("Available applications:\n")
+		for _, app := range cfg.Applications {
+			fmt.Printf("  - %s\n", app.Name)
+		}
+		os.Exit(1)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+}
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"mess/pkg/config"
+	"mess/pkg/output"
+	"mess/pkg/repo"
+)
+
+var (
+	foreachRepos    []string
+	foreachApp      string
+	foreachParallel int
+)
+
+// foreachCmd represents the foreach command
+var foreachCmd = &cobra.Command{
+	Use:   "foreach [--repos a,b] [--app name] [--parallel N] -- <command> [args...]",
+	Short: "Run a command in every cloned repository",
+	Long: `Run a git or shell command in the directory of every selected repository.
+A single argument is run with 'sh -c', so it may contain pipes and other shell syntax.
+Multiple arguments are executed directly, e.g. 'mess foreach -- git pull --ff-only'.
+
+By default every repository in mess.json is selected; use --repos and --app to
+narrow the selection. Repositories that are not cloned are skipped.
+Output lines are prefixed with the repository name and a summary of exit codes
+is printed at the end. mess exits with a non-zero code if any command failed.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Load configuration
+		cfg := loadResolvedConfig()
+
+		// Get config file directory
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		selected, err := selectRepos(cfg, foreachRepos, foreachApp)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		stdout := output.Stdout()
+		stderr := output.Stderr()
+		exitCodes := make([]int, len(selected))
+		skipped := make([]bool, len(selected))
+		// signaled describes how a command killed by a signal ended, e.g. "signal: killed"
+		signaled := make([]string, len(selected))
+
+		repo.ForEach(selected, foreachParallel, func(i int, repoDef *config.RepoDefinition) error {
+			if !repo.IsRepositoryCloned(repoDef.Name, configPath) {
+				skipped[i] = true
+				return nil
+			}
+
+			outWriter := stdout.Writer(repoDef.Name)
+			errWriter := stderr.Writer(repoDef.Name)
+			defer outWriter.Close()
+			defer errWriter.Close()
+
+			var execCmd *exec.Cmd
+			if len(args) == 1 {
+				execCmd = exec.Command("sh", "-c", args[0])
+			} else {
+				execCmd = exec.Command(args[0], args[1:]...)
+			}
+			execCmd.Dir = repo.GetRepositoryPath(repoDef.Name, configPath)
+			execCmd.Env = os.Environ()
+			for _, env := range []map[string]string{cfg.Env, repoDef.Env} {
+				for key, value := range env {
+					execCmd.Env = append(execCmd.Env, key+"="+value)
+				}
+			}
+			execCmd.Stdout = outWriter
+			execCmd.Stderr = errWriter
+
+			if err := execCmd.Run(); err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					exitCodes[i] = exitErr.ExitCode()
+					if exitCodes[i] < 0 {
+						signaled[i] = exitErr.ProcessState.String()
+					}
+				} else {
+					fmt.Fprintf(errWriter, "%v\n", err)
+					exitCodes[i] = 127
+				}
+			}
+			return nil
+		})
+
+		// Print summary
+		failed := 0
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REPO\tEXIT")
+		for i, repoDef := range selected {
+			switch {
+			case skipped[i]:
+				fmt.Fprintf(w, "%s\tskipped (not cloned)\n", repoDef.Name)
+			case signaled[i] != "":
+				failed++
+				fmt.Fprintf(w, "%s\t%s\n", repoDef.Name, signaled[i])
+			case exitCodes[i] != 0:
+				failed++
+				fmt.Fprintf(w, "%s\t%d\n", repoDef.Name, exitCodes[i])
+			default:
+				fmt.Fprintf(w, "%s\t0\n", repoDef.Name)
+			}
+		}
+		w.Flush()
+
+		if failed > 0 {
+			fmt.Printf("Command failed in %d out of %d repositories\n", failed, len(selected))
+			os.Exit(1)
+		}
+	},
+}
+
+// selectRepos returns the repositories named in repoNames and/or linked to the
+// application appName, or every repository if neither is given
+func selectRepos(cfg *config.MessConfig, repoNames []string, appName string) ([]config.RepoDefinition, error) {
+	wanted := make(map[string]bool)
+	for _, repoName := range repoNames {
+		if indexOfRepo(cfg.Repos, repoName) == -1 {
+			return nil, fmt.Errorf("repository '%s' not found in configuration", repoName)
+		}
+		wanted[repoName] = true
+	}
+
+	if appName != "" {
+		var targetApp *config.ApplicationDefinition
+		for _, app := range cfg.Applications {
+			if app.Name == appName {
+				targetApp = &app
+				break
+			}
+		}
+		if targetApp == nil {
+			return nil, fmt.Errorf("application '%s' not found", appName)
+		}
+
+		appRepos := make(map[string]bool)
+		for _, repoName := range targetApp.Repos {
+			appRepos[repoName] = true
+		}
+		if len(wanted) > 0 {
+			for repoName := range wanted {
+				if !appRepos[repoName] {
+					return nil, fmt.Errorf("repository '%s' is not linked to application '%s'", repoName, appName)
+				}
+			}
+		} else {
+			wanted = appRepos
+		}
+	}
+
+	if len(repoNames) == 0 && appName == "" {
+		return cfg.Repos, nil
+	}
+
+	var selected []config.RepoDefinition
+	for _, repoDef := range cfg.Repos {
+		if wanted[repoDef.Name] {
+			selected = append(selected, repoDef)
+		}
+	}
+	return selected, nil
+}
+
+// indexOfRepo returns the index of the named repository, or -1 if it is not found
+func indexOfRepo(repos []config.RepoDefinition, repoName string) int {
+	for i, repoDef := range repos {
+		if repoDef.Name == repoName {
+			return i
+		}
+	}
+	return -1
+}
+
+func init() {
+	rootCmd.AddCommand(foreachCmd)
+	foreachCmd.Flags().SetInterspersed(false)
+	foreachCmd.Flags().StringSliceVar(&foreachRepos, "repos", nil, "comma separated list of repositories to run in")
+	foreachCmd.Flags().StringVar(&foreachApp, "app", "", "only run in repositories linked to this application")
+	foreachCmd.Flags().IntVarP(&foreachParallel, "parallel", "p", 4, "maximum number of repositories to run in at once")
+}
@@ -48,6 +48,7 @@ You can specify a project name using -n/--name flag, otherwise the current direc
 
 		// Create empty configuration with project name
 		emptyConfig := &config.MessConfig{
+			Version:      config.CurrentVersion,
 			Name:         finalProjectName,
 			Repos:        []config.RepoDefinition{},
 			Applications: []config.ApplicationDefinition{},
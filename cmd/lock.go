@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"mess/pkg/config"
+	"mess/pkg/repo"
+)
+
+// lockCmd represents the lock command
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Record the commit of every cloned repository in mess.lock",
+	Long: `Write a mess.lock file next to mess.json that records the exact commit checked
+out in every cloned repository under repos/.
+Use 'mess sync --locked' or 'mess app <application-name> setup --locked' to
+reproduce the workspace from the lock file.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Load configuration
+		cfg := loadResolvedConfig()
+
+		useGitBackend(cfg)
+
+		// Get config file directory
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		// Resolve the commit of every cloned repository
+		lock := &config.LockFile{Repos: []config.LockedRepo{}}
+		for _, repoDef := range cfg.Repos {
+			if !repo.IsRepositoryCloned(repoDef.Name, configPath) {
+				fmt.Printf("Repository '%s' is not cloned, skipping\n", repoDef.Name)
+				continue
+			}
+
+			commit, err := repo.GetRepositoryCommit(repoDef.Name, configPath)
+			if err != nil {
+				fmt.Printf("Error resolving commit of repository '%s': %v\n", repoDef.Name, err)
+				os.Exit(1)
+			}
+
+			lock.Repos = append(lock.Repos, config.LockedRepo{
+				Name:   repoDef.Name,
+				URL:    repoDef.URL,
+				Commit: commit,
+			})
+			fmt.Printf("Locked repository '%s' at %s\n", repoDef.Name, commit)
+		}
+
+		// Save lock file
+		if err := config.SaveLock(lock, configPath); err != nil {
+			fmt.Printf("Error saving lock file: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Successfully wrote %s with %d repositories\n", config.LockPath(configPath), len(lock.Repos))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+}
@@ -5,7 +5,7 @@ import (
 	"os"
 	"bufio"
 	"strings"
-	"os/exec"
+	"context"
 
 	"github.com/spf13/cobra"
 	"mess/pkg/config"
@@ -199,11 +199,9 @@ func handleRepoGet(repoName string, args []string) {
 	}
 
 	// Load configuration
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
-	}
+	cfg := loadResolvedConfig()
+
+	useGitBackend(cfg)
 
 	// Find repository
 	var targetRepo *config.RepoDefinition
@@ -225,6 +223,15 @@ func handleRepoGet(repoName string, args []string) {
 		configPath = "mess.json"
 	}
 
+	// Warn if an existing checkout is not on the pinned ref
+	if repo.IsRepositoryCloned(repoName, configPath) {
+		if mismatch, err := repo.CheckRepositoryRef(targetRepo, configPath); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else if mismatch != "" {
+			fmt.Printf("Warning: %s\n", mismatch)
+		}
+	}
+
 	// Clone repository
 	if err := repo.CloneRepository(targetRepo, configPath); err != nil {
 		fmt.Printf("Error cloning repository: %v\n", err)
@@ -237,11 +244,9 @@ func handleRepoGet(repoName string, args []string) {
 // handleRepoGitCommand handles git command delegation
 func handleRepoGitCommand(repoName string, gitCommand string, args []string) {
 	// Load configuration
-	cfg, err := config.LoadConfig(configFile)
-	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		os.Exit(1)
-	}
+	cfg := loadResolvedConfig()
+
+	useGitBackend(cfg)
 
 	// Find repository
 	var targetRepo *config.RepoDefinition
@@ -279,13 +284,7 @@ func handleRepoGitCommand(repoName string, gitCommand string, args []string) {
 	fmt.Printf("Executing: git %s in %s\n", strings.Join(gitArgs, " "), repoPath)
 
 	// Execute git command
-	cmd := exec.Command("git", gitArgs...)
-	cmd.Dir = repoPath
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-
-	if err := cmd.Run(); err != nil {
+	if err := repo.RunGitCommand(context.Background(), repoName, configPath, gitArgs); err != nil {
 		fmt.Printf("Git command failed: %v\n", err)
 		os.Exit(1)
 	}
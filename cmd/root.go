@@ -1,10 +1,20 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
+	"mess/pkg/config"
+	"mess/pkg/output"
+	"mess/pkg/repo"
 )
 
-var configFile string
+var (
+	configFile string
+	gitBackend string
+	noColor    bool
+)
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -21,6 +31,17 @@ Use mess.json file to define your project structure and manage repositories and
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		output.SetNoColor(noColor)
+
+		// Commands run from a subdirectory of the project use the project's config file,
+		// except init, which creates one in the current directory
+		if configFile == "" && cmd != initCmd {
+			if wd, err := os.Getwd(); err == nil {
+				configFile = config.FindConfig(wd)
+			}
+		}
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -34,9 +55,49 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	rootCmd.PersistentFlags().StringVarP(&configFile, "file", "f", "", "config file path (default is mess.json in current directory)")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "file", "f", "", "config file path (default is $MESS_CONFIG, then mess.json in the current directory or the nearest parent directory)")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "disable colored output prefixes (also disabled when stdout is not a terminal or NO_COLOR is set)")
+	rootCmd.PersistentFlags().StringVar(&gitBackend, "git-backend", "", "git implementation to use: exec or go-git (default is git_backend from mess.json, then exec)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-} 
\ No newline at end of file
+}
+
+// useGitBackend selects the git backend from the --git-backend flag or the
+// git_backend setting of the configuration
+func useGitBackend(cfg *config.MessConfig) {
+	name := gitBackend
+	if name == "" {
+		name = cfg.GitBackend
+	}
+
+	backend, err := repo.NewBackend(name)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	repo.SetBackend(backend)
+}
+
+// loadResolvedConfig loads the configuration with its variable references expanded, for
+// commands that use the configuration without saving it
+func loadResolvedConfig() *config.MessConfig {
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	configPath := configFile
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+
+	resolved, err := config.Resolve(cfg, configPath)
+	if err != nil {
+		fmt.Printf("Error in config: %v\n", err)
+		os.Exit(1)
+	}
+	return resolved
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"mess/pkg/repo"
+)
+
+var (
+	statusJSON    bool
+	statusVerbose bool
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of every repository",
+	Long: `Show the status of every repository defined in mess.json: whether it is cloned,
+the current branch, the number of dirty files, how far it is ahead of or behind
+its upstream branch and whether its origin remote matches the configured URL.
+The table shows the first line of errors; use --verbose or --json for the full messages.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Load configuration
+		cfg := loadResolvedConfig()
+
+		useGitBackend(cfg)
+
+		// Get config file directory
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		statuses := make([]*repo.RepositoryStatus, 0, len(cfg.Repos))
+		for _, repoDef := range cfg.Repos {
+			statuses = append(statuses, repo.GetRepositoryStatus(&repoDef, configPath))
+		}
+
+		if statusJSON {
+			data, err := json.MarshalIndent(statuses, "", "  ")
+			if err != nil {
+				fmt.Printf("Error encoding status: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(data))
+			return
+		}
+
+		printStatusTable(statuses, statusVerbose)
+	},
+}
+
+// printStatusTable prints repository statuses as an aligned table. Errors, such as the
+// output of a failed git command, are shortened to their first line to keep the columns;
+// with verbose the full errors are printed below the table
+func printStatusTable(statuses []*repo.RepositoryStatus, verbose bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tSTATE\tBRANCH\tDIRTY\tAHEAD/BEHIND\tURL")
+
+	for _, status := range statuses {
+		if !status.Cloned {
+			fmt.Fprintf(w, "%s\tnot cloned\t-\t-\t-\t-\n", status.Name)
+			continue
+		}
+		if status.Error != "" {
+			fmt.Fprintf(w, "%s\terror: %s\t-\t-\t-\t-\n", status.Name, firstLine(status.Error))
+			continue
+		}
+
+		branch := status.Branch
+		if branch == "" {
+			branch = "(detached " + status.Commit[:7] + ")"
+		}
+
+		tracking := "-"
+		if status.Upstream != "" {
+			tracking = fmt.Sprintf("+%d/-%d", status.Ahead, status.Behind)
+		}
+
+		url := "ok"
+		if !status.URLMatches {
+			url = "mismatch: " + status.RemoteURL
+			if status.RemoteURL == "" {
+				url = "no origin remote"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\tcloned\t%s\t%d\t%s\t%s\n", status.Name, branch, status.Dirty, tracking, url)
+	}
+
+	w.Flush()
+
+	// Print the errors that did not fit in the table
+	truncated := false
+	for _, status := range statuses {
+		if status.Cloned && status.Error != "" && firstLine(status.Error) != strings.TrimSpace(status.Error) {
+			if !verbose {
+				truncated = true
+				continue
+			}
+			fmt.Printf("\n%s:\n  %s\n", status.Name, strings.ReplaceAll(strings.TrimSpace(status.Error), "\n", "\n  "))
+		}
+	}
+	if truncated {
+		fmt.Println("\nSome errors were shortened, run 'mess status --verbose' to see them in full")
+	}
+}
+
+// firstLine returns the first non-empty line of a message, trimmed
+func firstLine(message string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return strings.TrimSpace(line)
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "print the status as JSON")
+	statusCmd.Flags().BoolVarP(&statusVerbose, "verbose", "v", false, "print the full error messages below the table")
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"mess/pkg/app"
+	"mess/pkg/config"
+)
+
+// superviseCmd runs a single application service in the foreground. It is started in the
+// background by 'mess app <name> up' and is not meant to be run directly
+var superviseCmd = &cobra.Command{
+	Use:    "supervise <application-name> <service-name>",
+	Short:  "Run and restart an application service (used by 'mess app <name> up')",
+	Args:   cobra.ExactArgs(2),
+	Hidden: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Load configuration
+		cfg := loadResolvedConfig()
+
+		// Find application
+		var targetApp *config.ApplicationDefinition
+		for _, application := range cfg.Applications {
+			if application.Name == args[0] {
+				targetApp = &application
+				break
+			}
+		}
+		if targetApp == nil {
+			fmt.Printf("Application '%s' not found\n", args[0])
+			os.Exit(1)
+		}
+
+		// Get config file directory
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		if err := app.SuperviseService(targetApp, args[1], configPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(superviseCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"mess/pkg/config"
+	"mess/pkg/output"
+	"mess/pkg/repo"
+)
+
+var (
+	syncLocked bool
+	syncApp    string
+	syncJobs   int
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:     "sync",
+	Aliases: []string{"pull"},
+	Short:   "Clone missing repositories and update existing ones",
+	Long: `Clone every repository that is defined in mess.json but not yet cloned, and
+fetch and fast-forward every repository that is already cloned.
+Repositories pinned to a branch, ref or commit are checked out at it first.
+Repositories with uncommitted changes are skipped.
+
+Use --app to only sync the repositories of one application.
+With --locked, every repository is checked out at the commit recorded in mess.lock.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Load configuration
+		cfg := loadResolvedConfig()
+
+		useGitBackend(cfg)
+
+		// Get config file directory
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		// Pin repositories to the locked commits
+		if syncLocked {
+			applyLock(cfg, configPath)
+		}
+
+		selected, err := selectRepos(cfg, nil, syncApp)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Abort running clones and skip the remaining repositories on Ctrl-C
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		mux := output.Stdout()
+		results := make([]repo.SyncResult, len(selected))
+		repo.ForEach(selected, syncJobs, func(i int, repoDef *config.RepoDefinition) error {
+			out := mux.Writer(repoDef.Name)
+			defer out.Close()
+			results[i] = repo.SyncRepository(ctx, repoDef, configPath, out)
+			return nil
+		})
+
+		// Print summary
+		failed := 0
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REPO\tRESULT\tDETAILS")
+		for i, repoDef := range selected {
+			if results[i].State == repo.SyncFailed {
+				failed++
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", repoDef.Name, results[i].State, results[i].Detail)
+		}
+		w.Flush()
+
+		if failed > 0 {
+			fmt.Printf("Failed to sync %d out of %d repositories\n", failed, len(selected))
+			os.Exit(1)
+		}
+
+		fmt.Printf("Successfully synced %d repositories\n", len(selected))
+	},
+}
+
+// applyLock pins the repositories of the configuration to the commits recorded in mess.lock
+func applyLock(cfg *config.MessConfig, configPath string) {
+	lock, err := config.LoadLock(configPath)
+	if err != nil {
+		fmt.Printf("Error loading lock file: %v\n", err)
+		os.Exit(1)
+	}
+
+	unlocked, err := lock.Apply(cfg)
+	if err != nil {
+		fmt.Printf("Error applying lock file: %v\n", err)
+		os.Exit(1)
+	}
+	for _, repoName := range unlocked {
+		fmt.Printf("Warning: repository '%s' is not recorded in %s\n", repoName, config.LockPath(configPath))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().BoolVar(&syncLocked, "locked", false, "check out the commits recorded in mess.lock")
+	syncCmd.Flags().StringVar(&syncApp, "app", "", "only sync the repositories of this application")
+	syncCmd.Flags().IntVarP(&syncJobs, "jobs", "j", 4, "maximum number of repositories to sync at once")
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"mess/pkg/config"
+)
+
+var validateFormat string
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file and report every problem",
+	Long: `Load mess.json with its included and local override files and report every problem
+found, each with the file, line and column it comes from:
+
+  mess.json:14:9: application web references non-existent repo: api
+
+Use --format json or --format sarif for CI; SARIF output can be uploaded as code
+scanning results. The command exits with status 1 when there are problems.`,
+	Example: `  mess validate
+  mess validate --format sarif > mess.sarif`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath := configFile
+		if configPath == "" {
+			configPath = "mess.json"
+		}
+
+		problems := validateConfigFile(configPath)
+
+		switch strings.ToLower(validateFormat) {
+		case "text":
+			for _, problem := range problems {
+				fmt.Println(problem)
+			}
+			switch len(problems) {
+			case 0:
+				fmt.Printf("%s is valid\n", configPath)
+			case 1:
+				fmt.Println("1 problem")
+			default:
+				fmt.Printf("%d problems\n", len(problems))
+			}
+		case "json":
+			printJSON(map[string]interface{}{"valid": len(problems) == 0, "problems": problems})
+		case "sarif":
+			printJSON(sarifReport(problems))
+		default:
+			fmt.Printf("Error: unknown format: %s (available: text, json, sarif)\n", validateFormat)
+			os.Exit(1)
+		}
+
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// validateConfigFile loads and resolves the config file and returns the problems found
+func validateConfigFile(configPath string) []config.Problem {
+	cfg, err := config.LoadConfig(configPath)
+	if err == nil {
+		_, err = config.Resolve(cfg, configPath)
+	}
+	if err == nil {
+		return []config.Problem{}
+	}
+
+	var validationError *config.ValidationError
+	if errors.As(err, &validationError) {
+		return validationError.Problems
+	}
+	return []config.Problem{{File: filepath.Base(configPath), Message: err.Error()}}
+}
+
+// sarifReport formats problems as a SARIF 2.1.0 log
+func sarifReport(problems []config.Problem) map[string]interface{} {
+	results := []interface{}{}
+	for _, problem := range problems {
+		result := map[string]interface{}{
+			"ruleId":  "mess/config",
+			"level":   "error",
+			"message": map[string]interface{}{"text": problem.Message},
+		}
+		if problem.File != "" {
+			location := map[string]interface{}{
+				"artifactLocation": map[string]interface{}{"uri": filepath.ToSlash(problem.File)},
+			}
+			if problem.Line > 0 {
+				location["region"] = map[string]interface{}{"startLine": problem.Line, "startColumn": problem.Column}
+			}
+			result["locations"] = []interface{}{map[string]interface{}{"physicalLocation": location}}
+		}
+		results = append(results, result)
+	}
+
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool": map[string]interface{}{
+					"driver": map[string]interface{}{
+						"name":           "mess",
+						"informationUri": "https://github.com/hus201/mess-manager",
+						"rules": []interface{}{
+							map[string]interface{}{
+								"id":               "mess/config",
+								"shortDescription": map[string]interface{}{"text": "Invalid mess configuration"},
+							},
+						},
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+}
+
+// printJSON prints a value as indented JSON
+func printJSON(value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		fmt.Printf("Error marshaling output: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().StringVar(&validateFormat, "format", "text", "output format: text, json or sarif")
+}
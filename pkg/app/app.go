@@ -1,18 +1,26 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"mess/pkg/config"
+	"mess/pkg/output"
 	"mess/pkg/repo"
 )
 
-// SetupApplication sets up an application by cloning repos and creating symlinks
-func SetupApplication(app *config.ApplicationDefinition, cfg *config.MessConfig, configPath string) error {
+// SetupApplication sets up an application by cloning repos and creating symlinks.
+// Missing repositories are cloned by up to jobs concurrent workers. With locked, the
+// repositories that are already cloned are moved to the commit they are pinned to
+func SetupApplication(ctx context.Context, app *config.ApplicationDefinition, cfg *config.MessConfig, configPath string, jobs int, locked bool) error {
 	// Get the directory containing the config file
 	configDir := filepath.Dir(configPath)
 	if configDir == "." {
@@ -41,33 +49,14 @@ func SetupApplication(app *config.ApplicationDefinition, cfg *config.MessConfig,
 	// Execute pre-setup script if defined
 	if app.PreSetup != "" {
 		fmt.Printf("Executing pre-setup script for application '%s'...\n", app.Name)
-		if err := runSingleCommand(app.PreSetup, appDir, app.Env); err != nil {
+		if err := runSingleCommand(ctx, app.PreSetup, commandOptions{dir: appDir, env: app.Env}); err != nil {
 			return fmt.Errorf("pre-setup script failed: %v", err)
 		}
 	}
 
-	// Get repository definitions for the application
-	var reposToProcess []config.RepoDefinition
-	for _, repoName := range app.Repos {
-		for _, repo := range cfg.Repos {
-			if repo.Name == repoName {
-				reposToProcess = append(reposToProcess, repo)
-				break
-			}
-		}
-	}
-
 	// Step 1: Clone any missing repositories
-	fmt.Printf("Checking repositories for application '%s'...\n", app.Name)
-	for _, repoToProcess := range reposToProcess {
-		if !repo.IsRepositoryCloned(repoToProcess.Name, configPath) {
-			fmt.Printf("Repository '%s' not found, cloning...\n", repoToProcess.Name)
-			if err := repo.CloneRepository(&repoToProcess, configPath); err != nil {
-				return fmt.Errorf("failed to clone repository %s: %v", repoToProcess.Name, err)
-			}
-		} else {
-			fmt.Printf("Repository '%s' already cloned\n", repoToProcess.Name)
-		}
+	if err := cloneMissingRepositories(ctx, app, cfg, configPath, jobs, locked); err != nil {
+		return err
 	}
 
 	// Step 2: Create symbolic links
@@ -93,7 +82,7 @@ func SetupApplication(app *config.ApplicationDefinition, cfg *config.MessConfig,
 	// Execute post-setup script if defined
 	if app.PostSetup != "" {
 		fmt.Printf("Executing post-setup script for application '%s'...\n", app.Name)
-		if err := runSingleCommand(app.PostSetup, appDir, app.Env); err != nil {
+		if err := runSingleCommand(ctx, app.PostSetup, commandOptions{dir: appDir, env: app.Env}); err != nil {
 			return fmt.Errorf("post-setup script failed: %v", err)
 		}
 	}
@@ -101,8 +90,10 @@ func SetupApplication(app *config.ApplicationDefinition, cfg *config.MessConfig,
 	return nil
 }
 
-// CloneApplication clones application repositories and creates symlinks without setup scripts
-func CloneApplication(app *config.ApplicationDefinition, cfg *config.MessConfig, configPath string) error {
+// CloneApplication clones application repositories and creates symlinks without setup scripts.
+// Missing repositories are cloned by up to jobs concurrent workers. With locked, the
+// repositories that are already cloned are moved to the commit they are pinned to
+func CloneApplication(ctx context.Context, app *config.ApplicationDefinition, cfg *config.MessConfig, configPath string, jobs int, locked bool) error {
 	// Get the directory containing the config file
 	configDir := filepath.Dir(configPath)
 	if configDir == "." {
@@ -128,28 +119,9 @@ func CloneApplication(app *config.ApplicationDefinition, cfg *config.MessConfig,
 		return fmt.Errorf("failed to create application directory: %v", err)
 	}
 
-	// Get repository definitions for the application
-	var reposToProcess []config.RepoDefinition
-	for _, repoName := range app.Repos {
-		for _, repo := range cfg.Repos {
-			if repo.Name == repoName {
-				reposToProcess = append(reposToProcess, repo)
-				break
-			}
-		}
-	}
-
 	// Step 1: Clone any missing repositories
-	fmt.Printf("Checking repositories for application '%s'...\n", app.Name)
-	for _, repoToProcess := range reposToProcess {
-		if !repo.IsRepositoryCloned(repoToProcess.Name, configPath) {
-			fmt.Printf("Repository '%s' not found, cloning...\n", repoToProcess.Name)
-			if err := repo.CloneRepository(&repoToProcess, configPath); err != nil {
-				return fmt.Errorf("failed to clone repository %s: %v", repoToProcess.Name, err)
-			}
-		} else {
-			fmt.Printf("Repository '%s' already cloned\n", repoToProcess.Name)
-		}
+	if err := cloneMissingRepositories(ctx, app, cfg, configPath, jobs, locked); err != nil {
+		return err
 	}
 
 	// Step 2: Create symbolic links
@@ -175,66 +147,336 @@ func CloneApplication(app *config.ApplicationDefinition, cfg *config.MessConfig,
 	return nil
 }
 
-// RunScript runs a script for an application
-func RunScript(app *config.ApplicationDefinition, scriptName string, scriptValue *config.ScriptValue, configPath string) error {
-	// Get the directory containing the config file
-	configDir := filepath.Dir(configPath)
-	if configDir == "." {
-		configDir, _ = os.Getwd()
+// cloneMissingRepositories clones the repositories of an application that are not
+// cloned yet using up to jobs concurrent workers. The first failure cancels the
+// remaining clones; partial clones are removed by repo.CloneRepositoryContext. With
+// locked, cloned repositories are checked out at their locked commit, failing if they
+// have local changes
+func cloneMissingRepositories(ctx context.Context, app *config.ApplicationDefinition, cfg *config.MessConfig, configPath string, jobs int, locked bool) error {
+	// Get repository definitions for the application
+	var reposToProcess []config.RepoDefinition
+	for _, repoName := range app.Repos {
+		for _, repo := range cfg.Repos {
+			if repo.Name == repoName {
+				reposToProcess = append(reposToProcess, repo)
+				break
+			}
+		}
 	}
 
-	// Get applications directory - check MESS_APPLICATION_ROOT environment variable first
-	var appsDir string
-	if appRoot := os.Getenv("MESS_APPLICATION_ROOT"); appRoot != "" {
-		appsDir = appRoot
-	} else {
-		appsDir = filepath.Join(configDir, "applications")
+	fmt.Printf("Checking repositories for application '%s'...\n", app.Name)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mux := output.Stdout()
+	errs := repo.ForEach(reposToProcess, jobs, func(i int, repoToProcess *config.RepoDefinition) error {
+		out := mux.Writer(repoToProcess.Name)
+		defer out.Close()
+
+		if repo.IsRepositoryCloned(repoToProcess.Name, configPath) {
+			fmt.Fprintf(out, "Repository '%s' already cloned\n", repoToProcess.Name)
+			if locked {
+				// Reproduce the lock file rather than warn about a different checkout
+				return repo.CheckoutLockedCommit(ctx, repoToProcess, configPath, out)
+			}
+			if mismatch, err := repo.CheckRepositoryRef(repoToProcess, configPath); err != nil {
+				fmt.Fprintf(out, "Warning: %v\n", err)
+			} else if mismatch != "" {
+				fmt.Fprintf(out, "Warning: %s\n", mismatch)
+			}
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Repository '%s' not found, cloning...\n", repoToProcess.Name)
+		if err := repo.CloneRepositoryContext(ctx, repoToProcess, configPath, out); err != nil {
+			cancel()
+			return err
+		}
+		return nil
+	})
+
+	// Report every failed clone and the clones that were aborted after the first failure
+	var failures, aborted []string
+	for i, err := range errs {
+		if errors.Is(err, context.Canceled) {
+			aborted = append(aborted, reposToProcess[i].Name)
+		} else if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", reposToProcess[i].Name, err))
+		}
+	}
+	if len(failures) > 0 {
+		if len(aborted) > 0 {
+			failures = append(failures, "aborted: "+strings.Join(aborted, ", "))
+		}
+		return fmt.Errorf("failed to prepare repositories:\n  %s", strings.Join(failures, "\n  "))
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("cloning interrupted: %v", err)
 	}
 
+	return nil
+}
+
+// RunOptions controls how RunScript executes scripts
+type RunOptions struct {
+	// Sequential runs arrays of commands in order even if the script allows parallel execution
+	Sequential bool
+	// KeepGoing runs the remaining commands of a sequential script after a command fails
+	KeepGoing bool
+	// Args are extra arguments for the script, passed as positional parameters and in MESS_ARGS.
+	// They are appended to commands that do not reference $1, $@ and the like
+	Args []string
+}
+
+// RunScript runs a script for an application. Cancelling ctx stops the script
+func RunScript(ctx context.Context, app *config.ApplicationDefinition, scriptName string, scriptValue *config.ScriptValue, configPath string, opts RunOptions) error {
 	// Application directory
-	appDir := filepath.Join(appsDir, app.Name)
+	appDir := applicationDir(app, configPath)
 
 	// Check if application directory exists
 	if _, err := os.Stat(appDir); os.IsNotExist(err) {
 		return fmt.Errorf("application directory not found: %s. Run 'mess app setup %s' first", appDir, app.Name)
 	}
 
-	// Parse script value
-	if scriptValue.IsArray {
-		// Array of commands
-		return runMultipleCommands(scriptValue.Multiple, appDir, app.Env)
-	} else {
+	// Run dependencies first
+	if len(scriptValue.DependsOn) > 0 {
+		return runScriptGraph(ctx, app, scriptName, appDir, opts)
+	}
+
+	return runScript(ctx, app, scriptValue, appDir, opts, "")
+}
+
+// applicationDir returns the directory an application is set up in
+func applicationDir(app *config.ApplicationDefinition, configPath string) string {
+	return config.ApplicationDir(app.Name, configPath)
+}
+
+// commandOptions controls how commands are executed
+type commandOptions struct {
+	// dir is the working directory
+	dir string
+	// env is added to the environment of the mess process
+	env map[string]string
+	// shell interprets the command, sh if empty
+	shell string
+	// label prefixes the output of commands that run alongside other commands
+	label string
+	// args are the positional parameters of the commands
+	args []string
+	// background runs commands in their own process group, which is terminated as a whole when
+	// the command is cancelled
+	background bool
+}
+
+// runScript runs the commands of a script with its cwd, env, shell, timeout and parallel settings
+// The output is prefixed with label if it is not empty
+func runScript(ctx context.Context, app *config.ApplicationDefinition, scriptValue *config.ScriptValue, appDir string, runOpts RunOptions, label string) error {
+	opts := commandOptions{
+		dir:   scriptDir(app, scriptValue, appDir),
+		env:   app.Env,
+		shell: scriptValue.Shell,
+		label: label,
+	}
+
+	// Script environment variables override application environment variables
+	opts.env = mergeEnv(app.Env, scriptValue.Env)
+
+	// Extra arguments are available to every command of the script
+	if len(runOpts.Args) > 0 {
+		opts.args = runOpts.Args
+		opts.env = mergeEnv(opts.env, map[string]string{"MESS_ARGS": shellJoin(runOpts.Args)})
+	}
+
+	// Long-running scripts of a dependency graph keep running while the scripts that depend on
+	// them run, and are stopped afterwards. Labeled commands get no stdin, so they can run in
+	// their own process group
+	opts.background = scriptValue.Ready != nil && label != ""
+
+	if scriptValue.Timeout != "" {
+		timeout, err := time.ParseDuration(scriptValue.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", scriptValue.Timeout, err)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var err error
+	switch {
+	case !scriptValue.IsArray:
 		// Single command
-		return runSingleCommand(scriptValue.Single, appDir, app.Env)
+		err = runSingleCommand(ctx, scriptValue.Single, opts)
+	case scriptValue.IsParallel() && !runOpts.Sequential:
+		// Array of commands
+		err = runMultipleCommands(ctx, scriptValue.Multiple, opts)
+	default:
+		// Array of commands in order
+		err = runSequentialCommands(ctx, scriptValue.Multiple, opts, runOpts.KeepGoing)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("script timed out after %s", scriptValue.Timeout)
+	}
+	return err
+}
+
+// scriptDir returns the working directory of a script. The cwd setting names
+// either a repository of the application or a path relative to the application directory
+func scriptDir(app *config.ApplicationDefinition, scriptValue *config.ScriptValue, appDir string) string {
+	if scriptValue.Cwd == "" {
+		return appDir
+	}
+	if filepath.IsAbs(scriptValue.Cwd) {
+		return scriptValue.Cwd
+	}
+	// Repositories are linked into the application directory, so both cases resolve the same way
+	return filepath.Join(appDir, scriptValue.Cwd)
+}
+
+// newCommand creates a command that runs a command string through the configured shell
+func newCommand(ctx context.Context, command string, opts commandOptions) *exec.Cmd {
+	// The first argument after the command becomes $0
+	shellArgs := append([]string{"-c", withArgs(command, opts.args), "mess"}, opts.args...)
+	cmd := exec.CommandContext(ctx, shellOf(opts), shellArgs...)
+	cmd.Dir = opts.dir
+	cmd.Env = commandEnv(opts.env)
+	if opts.background {
+		newProcessGroup(cmd)
+		cmd.Cancel = func() error { return terminateGroup(cmd.Process.Pid) }
+		cmd.WaitDelay = stopTimeout
+	}
+	return cmd
+}
+
+// shellOf returns the shell that interprets commands, sh by default
+func shellOf(opts commandOptions) string {
+	if opts.shell == "" {
+		return "sh"
+	}
+	return opts.shell
+}
+
+// commandEnv returns the environment of a command: the environment of the mess process
+// with env added. It returns nil, which inherits the environment, if env is empty
+func commandEnv(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+
+	// Start with current environment
+	result := os.Environ()
+	// Add application-specific environment variables
+	for key, value := range env {
+		result = append(result, fmt.Sprintf("%s=%s", key, value))
 	}
+	return result
+}
+
+// mergeEnv returns base with the variables of override added, without modifying either map
+func mergeEnv(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// attachOutput connects the output of a command to the terminal. Commands with a
+// label run alongside others, so their output is line-buffered and prefixed with
+// the label instead, and they get no stdin. The returned function flushes the output
+func attachOutput(cmd *exec.Cmd, label string) func() {
+	if label == "" {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Stdin = os.Stdin
+		return func() {}
+	}
+
+	stdout := output.Stdout().Writer(label)
+	stderr := output.Stderr().Writer(label)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return func() {
+		stdout.Close()
+		stderr.Close()
+	}
+}
+
+// printf prints a progress message, prefixed with the label if there is one
+func printf(label string, format string, args ...interface{}) {
+	if label == "" {
+		fmt.Printf(format, args...)
+		return
+	}
+	out := output.Stdout().Writer(label)
+	fmt.Fprintf(out, format, args...)
+	out.Close()
 }
 
 // runSingleCommand executes a single command
-func runSingleCommand(command, workingDir string, env map[string]string) error {
-	fmt.Printf("Executing: %s\n", command)
-	
-	cmd := exec.Command("sh", "-c", command)
-	cmd.Dir = workingDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	
-	// Set environment variables
-	if env != nil && len(env) > 0 {
-		// Start with current environment
-		cmd.Env = os.Environ()
-		// Add application-specific environment variables
-		for key, value := range env {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+func runSingleCommand(ctx context.Context, command string, opts commandOptions) error {
+	printf(opts.label, "Executing: %s\n", withArgs(command, opts.args))
+
+	cmd := newCommand(ctx, command, opts)
+	defer attachOutput(cmd, opts.label)()
+
+	return cmd.Run()
+}
+
+// runSequentialCommands executes multiple commands in order. It stops at the first
+// failure unless keepGoing is set, in which case every command runs and all failures are reported
+func runSequentialCommands(ctx context.Context, commands []string, opts commandOptions, keepGoing bool) error {
+	printf(opts.label, "Executing %d commands in order...\n", len(commands))
+
+	var failures []string
+	for i, command := range commands {
+		printf(opts.label, "[%d] Executing: %s\n", i+1, withArgs(command, opts.args))
+
+		cmd := newCommand(ctx, command, opts)
+		flush := attachOutput(cmd, opts.label)
+		err := cmd.Run()
+		flush()
+
+		if err != nil {
+			failure := fmt.Sprintf("command [%d] failed: %s - %v", i+1, command, err)
+			if !keepGoing || ctx.Err() != nil {
+				if remaining := len(commands) - i - 1; remaining > 0 {
+					return fmt.Errorf("%s (%d remaining commands skipped)", failure, remaining)
+				}
+				return errors.New(failure)
+			}
+			failures = append(failures, failure)
 		}
 	}
 
-	return cmd.Run()
+	if len(failures) > 0 {
+		printf(opts.label, "Some commands failed:\n")
+		for _, failure := range failures {
+			printf(opts.label, "  - %s\n", failure)
+		}
+		return fmt.Errorf("%d out of %d commands failed", len(failures), len(commands))
+	}
+
+	return nil
 }
 
-// runMultipleCommands executes multiple commands in parallel
-func runMultipleCommands(commands []string, workingDir string, env map[string]string) error {
-	fmt.Printf("Executing %d commands in parallel...\n", len(commands))
+// runMultipleCommands executes multiple commands in parallel. The output of every
+// command is prefixed with its index, after the label of the script if there is one
+func runMultipleCommands(ctx context.Context, commands []string, opts commandOptions) error {
+	printf(opts.label, "Executing %d commands in parallel...\n", len(commands))
 	
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(commands))
@@ -243,26 +485,16 @@ func runMultipleCommands(commands []string, workingDir string, env map[string]st
 		wg.Add(1)
 		go func(idx int, cmd string) {
 			defer wg.Done()
-			
-			fmt.Printf("[%d] Executing: %s\n", idx+1, cmd)
-			
-			execCmd := exec.Command("sh", "-c", cmd)
-			execCmd.Dir = workingDir
-			// For parallel execution, we might want to prefix output
-			// but for simplicity, we'll let them write to stdout/stderr directly
-			execCmd.Stdout = os.Stdout
-			execCmd.Stderr = os.Stderr
-			
-			// Set environment variables
-			if env != nil && len(env) > 0 {
-				// Start with current environment
-				execCmd.Env = os.Environ()
-				// Add application-specific environment variables
-				for key, value := range env {
-					execCmd.Env = append(execCmd.Env, fmt.Sprintf("%s=%s", key, value))
-				}
+
+			label := strconv.Itoa(idx + 1)
+			if opts.label != "" {
+				label = opts.label + ":" + label
 			}
-			
+			printf(label, "Executing: %s\n", withArgs(cmd, opts.args))
+
+			execCmd := newCommand(ctx, cmd, opts)
+			defer attachOutput(execCmd, label)()
+
 			if err := execCmd.Run(); err != nil {
 				errChan <- fmt.Errorf("command [%d] failed: %s - %v", idx+1, cmd, err)
 			}
@@ -280,12 +512,12 @@ func runMultipleCommands(commands []string, workingDir string, env map[string]st
 	}
 
 	if len(errors) > 0 {
-		fmt.Printf("Some commands failed:\n")
+		printf(opts.label, "Some commands failed:\n")
 		for _, err := range errors {
-			fmt.Printf("  - %v\n", err)
+			printf(opts.label, "  - %v\n", err)
 		}
 		return fmt.Errorf("%d out of %d commands failed", len(errors), len(commands))
 	}
 
 	return nil
-} 
\ No newline at end of file
+}
\ No newline at end of file
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"mess/pkg/config"
+)
+
+func TestRunSequentialScript(t *testing.T) {
+	sequential := false
+	commands := []string{"echo 1 >> log", "exit 2", "echo 3 >> log", "exit 4", "echo 5 >> log"}
+
+	tests := []struct {
+		name    string
+		script  config.ScriptValue
+		opts    RunOptions
+		wantErr string
+		wantLog []string
+	}{
+		{
+			name:    "parallel false stops at the first failure",
+			script:  config.ScriptValue{Multiple: commands, IsArray: true, Parallel: &sequential},
+			wantErr: "command [2] failed: exit 2 - exit status 2 (3 remaining commands skipped)",
+			wantLog: []string{"1"},
+		},
+		{
+			name:    "sequential option stops at the first failure",
+			script:  config.ScriptValue{Multiple: commands, IsArray: true},
+			opts:    RunOptions{Sequential: true},
+			wantErr: "command [2] failed: exit 2 - exit status 2 (3 remaining commands skipped)",
+			wantLog: []string{"1"},
+		},
+		{
+			name:    "failure of the last command",
+			script:  config.ScriptValue{Multiple: []string{"echo 1 >> log", "exit 2"}, IsArray: true, Parallel: &sequential},
+			wantErr: "command [2] failed: exit 2 - exit status 2",
+			wantLog: []string{"1"},
+		},
+		{
+			name:    "keep going runs every command",
+			script:  config.ScriptValue{Multiple: commands, IsArray: true, Parallel: &sequential},
+			opts:    RunOptions{KeepGoing: true},
+			wantErr: "2 out of 5 commands failed",
+			wantLog: []string{"1", "3", "5"},
+		},
+		{
+			name:    "success",
+			script:  config.ScriptValue{Multiple: []string{"echo 1 >> log", "echo 2 >> log"}, IsArray: true},
+			opts:    RunOptions{Sequential: true, KeepGoing: true},
+			wantLog: []string{"1", "2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, appDir := testApp(t, map[string]config.ScriptValue{"build": tt.script})
+			err := runScript(context.Background(), app, &tt.script, appDir, tt.opts, "")
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("runScript() error = %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("runScript() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := readLog(t, appDir); !slices.Equal(got, tt.wantLog) {
+				t.Errorf("commands that ran = %v, want %v", got, tt.wantLog)
+			}
+		})
+	}
+}
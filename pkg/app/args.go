@@ -0,0 +1,38 @@
+package app
+
+import (
+	"regexp"
+	"strings"
+)
+
+// positionalParam matches references to positional parameters in a shell command: $1, ${10}, $@ and $*
+var positionalParam = regexp.MustCompile(`\$([1-9]|\{[0-9]+\}|@|\*)`)
+
+// safeShellWord matches words that need no quoting in a shell command
+var safeShellWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// withArgs returns the command to run with extra arguments. Commands that reference positional
+// parameters get the arguments as $1, $2, ... only; other commands get them appended
+func withArgs(command string, args []string) string {
+	if len(args) == 0 || positionalParam.MatchString(command) {
+		return command
+	}
+	return command + " " + shellJoin(args)
+}
+
+// shellJoin quotes the arguments for a POSIX shell and joins them with spaces
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote quotes a string for a POSIX shell, leaving it alone if that is not needed
+func shellQuote(s string) string {
+	if safeShellWord.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
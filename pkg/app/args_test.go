@@ -0,0 +1,79 @@
+package app
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{arg: "plain", want: "plain"},
+		{arg: "--grep=a,b:c/d.e@f%g+h", want: "--grep=a,b:c/d.e@f%g+h"},
+		{arg: "", want: "''"},
+		{arg: "two words", want: "'two words'"},
+		{arg: "it's", want: `'it'\''s'`},
+		{arg: "'", want: `''\'''`},
+		{arg: "$HOME", want: "'$HOME'"},
+		{arg: "$(rm -rf /)", want: "'$(rm -rf /)'"},
+		{arg: "`id`", want: "'`id`'"},
+		{arg: "a;b|c&d", want: "'a;b|c&d'"},
+		{arg: "*", want: "'*'"},
+		{arg: "line\nbreak", want: "'line\nbreak'"},
+		{arg: `back\slash "quoted"`, want: `'back\slash "quoted"'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			if got := shellQuote(tt.arg); got != tt.want {
+				t.Errorf("shellQuote(%q) = %s, want %s", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShellQuoteRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	args := []string{"plain", "", "two words", "it's", "$HOME", "$(echo injected)", "`id`", "a;b", "*", "line\nbreak", `\"`}
+
+	// The shell must see every argument exactly as it was given
+	for _, arg := range args {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(arg)).Output()
+		if err != nil {
+			t.Fatalf("sh -c printf %s: %v", shellQuote(arg), err)
+		}
+		if string(out) != arg {
+			t.Errorf("shell read %q as %q", shellQuote(arg), out)
+		}
+	}
+}
+
+func TestWithArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		want    string
+	}{
+		{name: "no arguments", command: "npm test", want: "npm test"},
+		{name: "appended", command: "npm test", args: []string{"--watch"}, want: "npm test --watch"},
+		{name: "appended and quoted", command: "go test", args: []string{"-run", "Test A", "it's", ""}, want: `go test -run 'Test A' 'it'\''s' ''`},
+		{name: "positional parameter", command: `npm test -- --grep "$1"`, args: []string{"a b"}, want: `npm test -- --grep "$1"`},
+		{name: "braced positional parameter", command: "echo ${10}", args: []string{"x"}, want: "echo ${10}"},
+		{name: "all parameters", command: `pytest "$@"`, args: []string{"-k", "x"}, want: `pytest "$@"`},
+		{name: "joined parameters", command: `echo "$*"`, args: []string{"x"}, want: `echo "$*"`},
+		{name: "not a positional parameter", command: "echo $0 $HOME", args: []string{"x"}, want: "echo $0 $HOME x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withArgs(tt.command, tt.args); got != tt.want {
+				t.Errorf("withArgs(%q, %q) = %s, want %s", tt.command, tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"mess/pkg/config"
+)
+
+// errNotStarted marks a long-running script that was no longer needed when its dependencies finished
+var errNotStarted = errors.New("not started")
+
+// scriptTask is a script scheduled as part of a dependency graph
+type scriptTask struct {
+	name  string
+	value config.ScriptValue
+	deps  []*scriptTask
+	err   error
+	// ready is closed when the scripts depending on this one may start: when it has
+	// finished or, for long-running scripts, when its readiness probe succeeded
+	ready    chan struct{}
+	readyErr error
+}
+
+// runScriptGraph runs a script after the scripts it depends on. Scripts whose
+// dependencies are satisfied run in parallel, and every script runs at most once.
+// Scripts with a readiness probe are long-running: their dependents start once the
+// probe succeeds, and they are stopped when every other script has finished
+func runScriptGraph(ctx context.Context, app *config.ApplicationDefinition, scriptName string, appDir string, opts RunOptions) error {
+	// Collect the script and its transitive dependencies; cycles are rejected by config.ValidateConfig
+	tasks := make(map[string]*scriptTask)
+	var collect func(name string) (*scriptTask, error)
+	collect = func(name string) (*scriptTask, error) {
+		if task, exists := tasks[name]; exists {
+			return task, nil
+		}
+		value, exists := app.Scripts[name]
+		if !exists {
+			return nil, fmt.Errorf("script '%s' not found in application '%s'", name, app.Name)
+		}
+
+		task := &scriptTask{name: name, value: value, ready: make(chan struct{})}
+		tasks[name] = task
+		for _, dep := range value.DependsOn {
+			depTask, err := collect(dep)
+			if err != nil {
+				return nil, err
+			}
+			task.deps = append(task.deps, depTask)
+		}
+		return task, nil
+	}
+	if _, err := collect(scriptName); err != nil {
+		return err
+	}
+
+	// Extra arguments are meant for the requested script, not for its dependencies
+	taskOpts := func(task *scriptTask) RunOptions {
+		if task.name == scriptName {
+			return opts
+		}
+		depOpts := opts
+		depOpts.Args = nil
+		return depOpts
+	}
+
+	// Long-running scripts are cancelled through backgroundCtx once the other scripts are done
+	backgroundCtx, stopBackground := context.WithCancel(ctx)
+	defer stopBackground()
+
+	var wg, backgroundWg sync.WaitGroup
+	for _, task := range tasks {
+		background := task.value.Ready != nil && task.name != scriptName
+		if background {
+			backgroundWg.Add(1)
+		} else {
+			wg.Add(1)
+		}
+		go func(task *scriptTask) {
+			defer func() {
+				if background {
+					backgroundWg.Done()
+				} else {
+					wg.Done()
+				}
+			}()
+
+			// Wait for all dependencies and skip the script if any of them failed
+			for _, dep := range task.deps {
+				<-dep.ready
+				if dep.readyErr != nil && task.err == nil {
+					task.err = fmt.Errorf("skipped because dependency '%s' failed", dep.name)
+				}
+			}
+			if task.err != nil || !task.value.HasCommand() {
+				task.readyErr = task.err
+				close(task.ready)
+				return
+			}
+
+			if !background {
+				fmt.Printf("Running script '%s'...\n", task.name)
+				task.err = runScript(ctx, app, &task.value, appDir, taskOpts(task), task.name)
+				task.readyErr = task.err
+				close(task.ready)
+				return
+			}
+
+			if backgroundCtx.Err() != nil {
+				task.err = errNotStarted
+				task.readyErr = task.err
+				close(task.ready)
+				return
+			}
+			task.err = runBackgroundScript(backgroundCtx, app, task, appDir, taskOpts(task))
+		}(task)
+	}
+	wg.Wait()
+
+	// Everything that needed the long-running scripts has finished
+	stopBackground()
+	backgroundWg.Wait()
+
+	// Report failures in a stable order
+	var failures []string
+	for name, task := range tasks {
+		if task.err != nil && task.err != errNotStarted {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, task.err))
+		}
+	}
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf("%d out of %d scripts failed:\n  %s", len(failures), len(tasks), strings.Join(failures, "\n  "))
+	}
+
+	return nil
+}
+
+// runBackgroundScript runs a long-running script and releases its dependents once its readiness
+// probe succeeds. It runs until ctx is cancelled, which is not an error once the script was ready
+func runBackgroundScript(ctx context.Context, app *config.ApplicationDefinition, task *scriptTask, appDir string, opts RunOptions) error {
+	scriptCtx, stopScript := context.WithCancel(ctx)
+	defer stopScript()
+
+	fmt.Printf("Starting script '%s'...\n", task.name)
+	finished := make(chan error, 1)
+	go func() { finished <- runScript(scriptCtx, app, &task.value, appDir, opts, task.name) }()
+
+	// Probe commands run with the settings of the script
+	probeOpts := commandOptions{
+		dir:   scriptDir(app, &task.value, appDir),
+		env:   mergeEnv(app.Env, task.value.Env),
+		shell: task.value.Shell,
+	}
+	probeCtx, stopProbe := context.WithCancelCause(scriptCtx)
+	defer stopProbe(nil)
+	probed := make(chan error, 1)
+	go func() { probed <- waitReady(probeCtx, task.value.Ready, probeOpts) }()
+
+	select {
+	case err := <-probed:
+		if err != nil {
+			// Keep the probe error rather than the error of the stopped script
+			task.readyErr = fmt.Errorf("not ready: %v", err)
+			close(task.ready)
+			stopScript()
+			<-finished
+			return task.readyErr
+		}
+		fmt.Printf("Script '%s' is ready\n", task.name)
+		task.readyErr = nil
+		close(task.ready)
+
+		err = <-finished
+		if ctx.Err() != nil {
+			// Stopped because it is no longer needed
+			return nil
+		}
+		return err
+
+	case err := <-finished:
+		if err != nil {
+			stopProbe(errors.New("script failed"))
+			<-probed
+			task.readyErr = err
+			close(task.ready)
+			return err
+		}
+
+		// The script may have started something in the background, e.g. a container
+		if err := <-probed; err != nil {
+			task.readyErr = fmt.Errorf("not ready: %v", err)
+			close(task.ready)
+			return task.readyErr
+		}
+		fmt.Printf("Script '%s' is ready\n", task.name)
+		close(task.ready)
+		return nil
+	}
+}
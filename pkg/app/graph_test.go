@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mess/pkg/config"
+)
+
+// testApp returns an application with the given scripts and a directory to run them in.
+// Scripts can append to the file "log" of that directory to record that they ran
+func testApp(t *testing.T, scripts map[string]config.ScriptValue) (*config.ApplicationDefinition, string) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	return &config.ApplicationDefinition{Name: "web", Scripts: scripts}, t.TempDir()
+}
+
+// readLog returns the lines of the file "log" of an application directory
+func readLog(t *testing.T, appDir string) []string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(appDir, "log"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+// logScript returns a script that appends name to the log after its dependencies
+func logScript(name string, deps ...string) config.ScriptValue {
+	return config.ScriptValue{Single: "echo " + name + " >> log", DependsOn: deps}
+}
+
+func TestRunScriptGraphOrder(t *testing.T) {
+	app, appDir := testApp(t, map[string]config.ScriptValue{
+		"install": logScript("install"),
+		"lint":    logScript("lint", "install"),
+		"build":   logScript("build", "install"),
+		"test":    logScript("test", "lint", "build"),
+		"unused":  logScript("unused"),
+	})
+
+	if err := runScriptGraph(context.Background(), app, "test", appDir, RunOptions{}); err != nil {
+		t.Fatalf("runScriptGraph() error = %v", err)
+	}
+
+	got := readLog(t, appDir)
+	if len(got) != 4 || got[0] != "install" || got[3] != "test" {
+		t.Fatalf("scripts ran in order %v, want install first, test last and every script once", got)
+	}
+	if middle := map[string]bool{got[1]: true, got[2]: true}; !middle["lint"] || !middle["build"] {
+		t.Errorf("scripts ran in order %v, want lint and build between install and test", got)
+	}
+}
+
+func TestRunScriptGraphFailure(t *testing.T) {
+	app, appDir := testApp(t, map[string]config.ScriptValue{
+		"install": {Single: "exit 3"},
+		"codegen": logScript("codegen"),
+		"build":   logScript("build", "install", "codegen"),
+		"test":    logScript("test", "build"),
+	})
+
+	err := runScriptGraph(context.Background(), app, "test", appDir, RunOptions{})
+	if err == nil {
+		t.Fatal("runScriptGraph() succeeded, want the failure of install")
+	}
+	for _, want := range []string{
+		"3 out of 4 scripts failed",
+		"install: exit status 3",
+		"build: skipped because dependency 'install' failed",
+		"test: skipped because dependency 'build' failed",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("runScriptGraph() error = %v, want %q", err, want)
+		}
+	}
+	if got := readLog(t, appDir); len(got) != 1 || got[0] != "codegen" {
+		t.Errorf("scripts that ran = %v, want only codegen", got)
+	}
+}
+
+func TestRunScriptGraphBackgroundScript(t *testing.T) {
+	app, appDir := testApp(t, map[string]config.ScriptValue{
+		// The server records its pid, becomes ready and runs until it is stopped
+		"server": {
+			Single: "echo $$ > pid; touch ready; exec sleep 60",
+			Ready:  &config.ReadinessProbe{Cmd: "test -f ready", Interval: "20ms", Timeout: "10s"},
+		},
+		"test": logScript("test", "server"),
+	})
+
+	start := time.Now()
+	if err := runScriptGraph(context.Background(), app, "test", appDir, RunOptions{}); err != nil {
+		t.Fatalf("runScriptGraph() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > stopTimeout {
+		t.Errorf("runScriptGraph() took %s, the server was not stopped", elapsed)
+	}
+	if got := readLog(t, appDir); len(got) != 1 || got[0] != "test" {
+		t.Errorf("scripts that ran = %v, want test", got)
+	}
+
+	data, err := os.ReadFile(filepath.Join(appDir, "pid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processAlive(pid) {
+		t.Errorf("server process %d is still running", pid)
+	}
+}
+
+func TestRunScriptGraphBackgroundScriptNotReady(t *testing.T) {
+	app, appDir := testApp(t, map[string]config.ScriptValue{
+		"server": {
+			Single: "exec sleep 60",
+			Ready:  &config.ReadinessProbe{Cmd: "false", Interval: "20ms", Timeout: "100ms"},
+		},
+		"test": logScript("test", "server"),
+	})
+
+	err := runScriptGraph(context.Background(), app, "test", appDir, RunOptions{})
+	if err == nil {
+		t.Fatal("runScriptGraph() succeeded, want the server not to be ready")
+	}
+	for _, want := range []string{"server: not ready: ", "test: skipped because dependency 'server' failed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("runScriptGraph() error = %v, want %q", err, want)
+		}
+	}
+	if got := readLog(t, appDir); len(got) != 0 {
+		t.Errorf("scripts that ran = %v, want none", got)
+	}
+}
+
+func TestRunScriptGraphArgs(t *testing.T) {
+	app, appDir := testApp(t, map[string]config.ScriptValue{
+		"install": {Single: "echo install >> log"},
+		"test":    {Single: "echo test >> log", DependsOn: []string{"install"}},
+	})
+
+	// Arguments go to the requested script only
+	if err := runScriptGraph(context.Background(), app, "test", appDir, RunOptions{Args: []string{"--watch"}}); err != nil {
+		t.Fatalf("runScriptGraph() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(appDir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "install\ntest --watch\n"; string(data) != want {
+		t.Errorf("log = %q, want %q", data, want)
+	}
+}
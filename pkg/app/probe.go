@@ -0,0 +1,88 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"mess/pkg/config"
+)
+
+// maxProbeAttempt bounds a single readiness check, so a hanging check cannot use up the whole timeout
+const maxProbeAttempt = 5 * time.Second
+
+// waitReady runs a readiness probe every interval until it succeeds, its timeout expires or ctx
+// is cancelled. Command probes run with opts. The error names the probe and its last failure
+func waitReady(ctx context.Context, probe *config.ReadinessProbe, opts commandOptions) error {
+	timeout, interval, err := probe.Durations()
+	if err != nil {
+		return fmt.Errorf("%s probe: %v", probe, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		attemptTimeout := maxProbeAttempt
+		if remaining := time.Until(deadline); remaining > 0 && remaining < attemptTimeout {
+			attemptTimeout = remaining
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err := checkReady(attemptCtx, probe, opts)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s probe aborted: %w", probe, context.Cause(ctx))
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%s probe failed after %s: %v", probe, timeout, err)
+		}
+
+		// Make a last attempt at the deadline
+		wait := interval
+		if remaining < wait {
+			wait = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s probe aborted: %w", probe, context.Cause(ctx))
+		case <-time.After(wait):
+		}
+	}
+}
+
+// checkReady runs a readiness probe once
+func checkReady(ctx context.Context, probe *config.ReadinessProbe, opts commandOptions) error {
+	switch {
+	case probe.TCP != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", probe.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case probe.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, probe.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return nil
+
+	default:
+		// The output of probe commands is not interesting, only their exit status
+		return newCommand(ctx, probe.Cmd, opts).Run()
+	}
+}
@@ -0,0 +1,43 @@
+//go:build windows
+
+package app
+
+import (
+	"os"
+	"os/exec"
+)
+
+// detachProcess starts cmd in a new session so it survives the terminal mess was started from
+func detachProcess(cmd *exec.Cmd) {}
+
+// newProcessGroup starts cmd in its own process group, so signals reach every process it spawns
+func newProcessGroup(cmd *exec.Cmd) {}
+
+// terminateGroup asks every process in the process group led by pid to terminate.
+// Windows has no termination signal, so the process is killed
+func terminateGroup(pid int) error {
+	return killGroup(pid)
+}
+
+// killGroup kills every process in the process group led by pid
+func killGroup(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
+
+// terminateProcess asks a single process to terminate
+func terminateProcess(pid int) error {
+	return killGroup(pid)
+}
+
+// processAlive reports whether a process with the given pid exists
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
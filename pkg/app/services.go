@@ -0,0 +1,520 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"mess/pkg/config"
+)
+
+// Service statuses recorded in the state file
+const (
+	ServiceStarting   = "starting"
+	ServiceRunning    = "running"
+	ServiceRestarting = "restarting"
+	ServiceExited     = "exited"
+	ServiceFailed     = "failed"
+	ServiceStopped    = "stopped"
+	// ServiceDead is reported for a service whose supervisor disappeared without recording it
+	ServiceDead = "dead"
+)
+
+const (
+	// stopTimeout is how long a service gets to exit after SIGTERM before it is killed
+	stopTimeout = 10 * time.Second
+	// initialBackoff and maxBackoff bound the delay between restarts of a crashing service
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+	// stableUptime is how long a service has to run for the restart delay to be reset
+	stableUptime = 30 * time.Second
+)
+
+// ServiceState is the state of a supervised service, stored in
+// .mess/apps/<application>/<service>.json next to mess.json
+type ServiceState struct {
+	Service string `json:"service"`
+	// PID is the process ID of the supervisor
+	PID int `json:"pid"`
+	// ChildPID is the process ID of the service command, which leads its own process group
+	ChildPID int    `json:"child_pid,omitempty"`
+	Status   string `json:"status"`
+	Restarts int    `json:"restarts"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	// StartedAt is when the service command was last started
+	StartedAt time.Time `json:"started_at"`
+	LogFile   string    `json:"log_file"`
+}
+
+// Active reports whether the service is supposed to be running
+func (s *ServiceState) Active() bool {
+	return s.Status == ServiceStarting || s.Status == ServiceRunning || s.Status == ServiceRestarting
+}
+
+// serviceStateDir returns the directory holding the state files and logs of an application's services
+func serviceStateDir(appName, configPath string) string {
+	configDir := filepath.Dir(configPath)
+	if configDir == "." {
+		configDir, _ = os.Getwd()
+	}
+	return filepath.Join(configDir, ".mess", "apps", appName)
+}
+
+// readServiceState reads the state file of a service. It returns nil if the service was never started
+func readServiceState(appName, serviceName, configPath string) (*ServiceState, error) {
+	data, err := os.ReadFile(filepath.Join(serviceStateDir(appName, configPath), serviceName+".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state of service %s: %v", serviceName, err)
+	}
+
+	var state ServiceState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state of service %s: %v", serviceName, err)
+	}
+	return &state, nil
+}
+
+// writeServiceState replaces the state file of a service atomically, so readers never see a partial file
+func writeServiceState(appName, configPath string, state *ServiceState) error {
+	dir := serviceStateDir(appName, configPath)
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state of service %s: %v", state.Service, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, state.Service+".json.*")
+	if err != nil {
+		return fmt.Errorf("failed to write state of service %s: %v", state.Service, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state of service %s: %v", state.Service, err)
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, state.Service+".json")); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write state of service %s: %v", state.Service, err)
+	}
+	return nil
+}
+
+// serviceNames returns the requested service names, or all services of the application in order
+func serviceNames(app *config.ApplicationDefinition, names []string) ([]string, error) {
+	if len(names) == 0 {
+		for name := range app.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, nil
+	}
+
+	for _, name := range names {
+		if _, exists := app.Services[name]; !exists {
+			return nil, fmt.Errorf("service '%s' not found in application '%s'", name, app.Name)
+		}
+	}
+	return names, nil
+}
+
+// startOrder returns the named services and the services they depend on, dependencies first
+func startOrder(app *config.ApplicationDefinition, names []string) []string {
+	var order []string
+	added := make(map[string]bool)
+	var add func(name string)
+	add = func(name string) {
+		if added[name] {
+			return
+		}
+		added[name] = true
+		// Cycles are rejected by config.ValidateConfig
+		for _, dep := range app.Services[name].DependsOn {
+			add(dep)
+		}
+		order = append(order, name)
+	}
+	for _, name := range names {
+		add(name)
+	}
+	return order
+}
+
+// StartServices starts the named services of an application and the services they depend on,
+// or all services if names is empty. Every service runs under a detached 'mess supervise'
+// process that outlives this one. Services with a readiness probe are waited for before the
+// next service starts, so dependents only start once their dependencies are ready
+func StartServices(app *config.ApplicationDefinition, configPath string, names []string) error {
+	names, err := serviceNames(app, names)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("application '%s' has no services", app.Name)
+	}
+	names = startOrder(app, names)
+
+	// Services run in the application directory
+	appDir := applicationDir(app, configPath)
+	if _, err := os.Stat(appDir); os.IsNotExist(err) {
+		return fmt.Errorf("application directory not found: %s. Run 'mess app setup %s' first", appDir, app.Name)
+	}
+
+	stateDir := serviceStateDir(app.Name, configPath)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %v", err)
+	}
+
+	// The supervisor loads the same configuration file, whatever its working directory
+	absConfigPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %v", err)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the mess executable: %v", err)
+	}
+
+	for _, name := range names {
+		state, err := readServiceState(app.Name, name, configPath)
+		if err != nil {
+			return err
+		}
+		if state != nil && state.Active() && processAlive(state.PID) {
+			fmt.Printf("Service '%s' is already running (pid %d)\n", name, state.PID)
+			if err := waitServiceReady(app, name, appDir, configPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		logPath := filepath.Join(stateDir, name+".log")
+		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file of service %s: %v", name, err)
+		}
+
+		cmd := exec.Command(executable, "--file", absConfigPath, "supervise", app.Name, name)
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+		detachProcess(cmd)
+		err = cmd.Start()
+		logFile.Close()
+		if err != nil {
+			return fmt.Errorf("failed to start service %s: %v", name, err)
+		}
+
+		if err := waitForSupervisor(app.Name, name, configPath, cmd); err != nil {
+			return fmt.Errorf("failed to start service %s: %v (see %s)", name, err, logPath)
+		}
+		fmt.Printf("Started service '%s' (pid %d), logging to %s\n", name, cmd.Process.Pid, logPath)
+
+		if err := waitServiceReady(app, name, appDir, configPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitServiceReady waits for the readiness probe of a service, if it has one. It gives up
+// early if the service stops running
+func waitServiceReady(app *config.ApplicationDefinition, name, appDir, configPath string) error {
+	service := app.Services[name]
+	if service.Ready == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	// Watch the state file for the service exiting
+	go func() {
+		ticker := time.NewTicker(200 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			state, err := readServiceState(app.Name, name, configPath)
+			if err == nil && state != nil && (!state.Active() || !processAlive(state.PID)) {
+				cancel(fmt.Errorf("service %s", state.Status))
+				return
+			}
+		}
+	}()
+
+	fmt.Printf("Waiting for service '%s' to be ready (%s)...\n", name, service.Ready)
+	opts := commandOptions{
+		dir:   serviceDir(&service, appDir),
+		env:   mergeEnv(app.Env, service.Env),
+		shell: service.Shell,
+	}
+	if err := waitReady(ctx, service.Ready, opts); err != nil {
+		logPath := filepath.Join(serviceStateDir(app.Name, configPath), name+".log")
+		return fmt.Errorf("service %s is not ready: %v (see %s)", name, err, logPath)
+	}
+	fmt.Printf("Service '%s' is ready\n", name)
+	return nil
+}
+
+// waitForSupervisor waits until a freshly started supervisor has recorded its state
+func waitForSupervisor(appName, serviceName, configPath string, cmd *exec.Cmd) error {
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		state, err := readServiceState(appName, serviceName, configPath)
+		if err != nil {
+			return err
+		}
+		if state != nil && state.PID == cmd.Process.Pid {
+			return nil
+		}
+
+		select {
+		case err := <-exited:
+			// Short-lived services may have run and exited already
+			if state, _ := readServiceState(appName, serviceName, configPath); state != nil && state.PID == cmd.Process.Pid {
+				return nil
+			}
+			if err == nil {
+				return fmt.Errorf("supervisor exited before starting the service")
+			}
+			return fmt.Errorf("supervisor exited: %v", err)
+		case <-deadline:
+			return fmt.Errorf("timed out waiting for the supervisor")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// StopServices stops the named services of an application, or all of them if names is empty.
+// Each service's process group gets SIGTERM and is killed if it does not exit in time
+func StopServices(app *config.ApplicationDefinition, configPath string, names []string) error {
+	names, err := serviceNames(app, names)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		state, err := readServiceState(app.Name, name, configPath)
+		if err != nil {
+			return err
+		}
+		if state == nil || !state.Active() || !processAlive(state.PID) {
+			fmt.Printf("Service '%s' is not running\n", name)
+			continue
+		}
+
+		fmt.Printf("Stopping service '%s' (pid %d)...\n", name, state.PID)
+		if err := terminateProcess(state.PID); err != nil {
+			return fmt.Errorf("failed to stop service %s: %v", name, err)
+		}
+
+		// The supervisor forwards the signal and waits stopTimeout itself, so give it a little longer
+		if !waitForExit(state.PID, stopTimeout+5*time.Second) {
+			fmt.Printf("Service '%s' did not stop in time, killing it\n", name)
+			killGroup(state.PID)
+			if state.ChildPID > 0 {
+				killGroup(state.ChildPID)
+			}
+			state.Status = ServiceStopped
+			if err := writeServiceState(app.Name, configPath, state); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// waitForExit polls until the process with the given pid has exited. It reports false on timeout
+func waitForExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !processAlive(pid) {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return !processAlive(pid)
+}
+
+// ServiceStatuses returns the state of every service of an application, sorted by name.
+// Services that were never started are reported as stopped
+func ServiceStatuses(app *config.ApplicationDefinition, configPath string) ([]*ServiceState, error) {
+	names, _ := serviceNames(app, nil)
+
+	states := make([]*ServiceState, 0, len(names))
+	for _, name := range names {
+		state, err := readServiceState(app.Name, name, configPath)
+		if err != nil {
+			return nil, err
+		}
+		if state == nil {
+			state = &ServiceState{Service: name, Status: ServiceStopped}
+		}
+		// A supervisor that was killed cannot record that it stopped
+		if state.Active() && !processAlive(state.PID) {
+			state.Status = ServiceDead
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// SuperviseService runs a service in the foreground, restarting it according to its restart
+// policy until it exits for good or the supervisor receives SIGTERM or SIGINT. Signals are
+// forwarded to the service's whole process group. This is the body of 'mess supervise'
+func SuperviseService(app *config.ApplicationDefinition, serviceName, configPath string) error {
+	service, exists := app.Services[serviceName]
+	if !exists {
+		return fmt.Errorf("service '%s' not found in application '%s'", serviceName, app.Name)
+	}
+
+	appDir := applicationDir(app, configPath)
+	opts := commandOptions{
+		dir:   serviceDir(&service, appDir),
+		env:   mergeEnv(app.Env, service.Env),
+		shell: service.Shell,
+	}
+
+	state := &ServiceState{
+		Service: serviceName,
+		PID:     os.Getpid(),
+		LogFile: filepath.Join(serviceStateDir(app.Name, configPath), serviceName+".log"),
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	backoff := initialBackoff
+	for {
+		cmd := exec.Command(shellOf(opts), "-c", service.Cmd)
+		cmd.Dir = opts.dir
+		cmd.Env = commandEnv(opts.env)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		newProcessGroup(cmd)
+
+		if err := cmd.Start(); err != nil {
+			state.Status = ServiceFailed
+			writeServiceState(app.Name, configPath, state)
+			return fmt.Errorf("failed to start service %s: %v", serviceName, err)
+		}
+
+		started := time.Now()
+		state.StartedAt = started
+		state.ChildPID = cmd.Process.Pid
+		state.Status = ServiceRunning
+		state.ExitCode = nil
+		if err := writeServiceState(app.Name, configPath, state); err != nil {
+			return err
+		}
+		logf("started '%s' (pid %d)", service.Cmd, cmd.Process.Pid)
+
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+
+		var waitErr error
+		select {
+		case waitErr = <-exited:
+		case sig := <-signals:
+			logf("received %s, stopping service", sig)
+			stopProcessGroup(cmd.Process.Pid, exited)
+			state.Status = ServiceStopped
+			return writeServiceState(app.Name, configPath, state)
+		}
+
+		exitCode := 0
+		if cmd.ProcessState != nil {
+			exitCode = cmd.ProcessState.ExitCode()
+		}
+		state.ExitCode = &exitCode
+		logf("service exited: %v", exitStatus(waitErr))
+
+		restart := service.Restart == config.RestartAlways ||
+			(service.Restart == config.RestartOnFailure && exitCode != 0)
+		if !restart {
+			state.Status = ServiceExited
+			if exitCode != 0 {
+				state.Status = ServiceFailed
+			}
+			return writeServiceState(app.Name, configPath, state)
+		}
+
+		// Back off exponentially while the service keeps crashing
+		if time.Since(started) >= stableUptime {
+			backoff = initialBackoff
+		}
+		state.Status = ServiceRestarting
+		state.Restarts++
+		if err := writeServiceState(app.Name, configPath, state); err != nil {
+			return err
+		}
+		logf("restarting in %s", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case sig := <-signals:
+			logf("received %s, not restarting", sig)
+			state.Status = ServiceStopped
+			return writeServiceState(app.Name, configPath, state)
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// stopProcessGroup sends SIGTERM to a process group and kills it if its leader does not exit within stopTimeout
+func stopProcessGroup(pid int, exited <-chan error) {
+	terminateGroup(pid)
+	select {
+	case <-exited:
+	case <-time.After(stopTimeout):
+		logf("service did not exit within %s, killing it", stopTimeout)
+		killGroup(pid)
+		<-exited
+	}
+}
+
+// serviceDir returns the working directory of a service
+func serviceDir(service *config.ServiceDefinition, appDir string) string {
+	if service.Cwd == "" {
+		return appDir
+	}
+	if filepath.IsAbs(service.Cwd) {
+		return service.Cwd
+	}
+	return filepath.Join(appDir, service.Cwd)
+}
+
+// exitStatus describes how a command exited
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
+
+// logf writes a timestamped supervisor message to the service log
+func logf(format string, args ...interface{}) {
+	fmt.Printf("[mess %s] %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
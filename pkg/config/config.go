@@ -1,17 +1,30 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 )
 
 // MessConfig represents the main configuration structure
 type MessConfig struct {
+	Schema       string                         `json:"$schema,omitempty"`
+	Version      int                            `json:"version,omitempty"`
 	Name         string                         `json:"name"`
+	GitBackend   string                         `json:"git_backend,omitempty"`
+	Env          map[string]string              `json:"env,omitempty"`
+	EnvFiles     []string                       `json:"env_files,omitempty"`
+	Include      []string                       `json:"include,omitempty"`
 	Repos        []RepoDefinition              `json:"repos"`
 	Applications []ApplicationDefinition       `json:"applications"`
+
+	// source is set by LoadConfig and used by SaveConfig
+	source *configSource
 }
 
 // RepoDefinition represents a repository definition
@@ -19,6 +32,38 @@ type RepoDefinition struct {
 	Name        string   `json:"name"`
 	URL         string   `json:"url"`
 	CloneParams []string `json:"clone_params,omitempty"`
+	Ref         string   `json:"ref,omitempty"`
+	Branch      string   `json:"branch,omitempty"`
+	Commit      string   `json:"commit,omitempty"`
+	// Env applies to commands run in the repository
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Revision returns the branch, ref or commit the repository is pinned to,
+// or an empty string if it follows the remote's default branch
+func (r *RepoDefinition) Revision() string {
+	switch {
+	case r.Commit != "":
+		return r.Commit
+	case r.Ref != "":
+		return r.Ref
+	default:
+		return r.Branch
+	}
+}
+
+// RevisionKind returns which of the branch, ref or commit fields pins the repository
+func (r *RepoDefinition) RevisionKind() string {
+	switch {
+	case r.Commit != "":
+		return "commit"
+	case r.Ref != "":
+		return "ref"
+	case r.Branch != "":
+		return "branch"
+	default:
+		return ""
+	}
 }
 
 // ApplicationDefinition represents an application definition
@@ -27,19 +72,168 @@ type ApplicationDefinition struct {
 	Repos     []string                   `json:"repos"`
 	Scripts   map[string]ScriptValue     `json:"scripts"`
 	Env       map[string]string          `json:"env,omitempty"`
+	EnvFiles  []string                   `json:"env_files,omitempty"`
 	PreSetup  string                     `json:"pre-setup,omitempty"`
 	PostSetup string                     `json:"post-setup,omitempty"`
+	Services  map[string]ServiceDefinition `json:"services,omitempty"`
 }
 
-// ScriptValue represents a script that can be either a string or array of strings
+// ServiceDefinition represents a long-running process of an application, managed by
+// 'mess app <name> up' and 'down'
+type ServiceDefinition struct {
+	Cmd string `json:"cmd"`
+	// Cwd is a repository name of the application or a path relative to the application directory
+	Cwd string `json:"cwd,omitempty"`
+	// Env is merged over the application environment
+	Env map[string]string `json:"env,omitempty"`
+	// Shell runs the command instead of sh, e.g. "bash"
+	Shell string `json:"shell,omitempty"`
+	// Restart is the restart policy: "no" (default), "on-failure" or "always"
+	Restart string `json:"restart,omitempty"`
+	// DependsOn names services of the same application that must be ready before this service starts
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Ready is checked to decide when the service is ready
+	Ready *ReadinessProbe `json:"ready,omitempty"`
+}
+
+// ReadinessProbe checks whether a long-running script or service is ready. Exactly one
+// of TCP, HTTP and Cmd is set
+type ReadinessProbe struct {
+	// TCP is an address such as "localhost:5432" that accepts connections once ready
+	TCP string `json:"tcp,omitempty"`
+	// HTTP is a URL that responds with a 2xx status once ready
+	HTTP string `json:"http,omitempty"`
+	// Cmd is a command that exits with status 0 once ready
+	Cmd string `json:"cmd,omitempty"`
+	// Timeout is how long to wait for readiness, 60s by default
+	Timeout string `json:"timeout,omitempty"`
+	// Interval is the delay between checks, 1s by default
+	Interval string `json:"interval,omitempty"`
+}
+
+// Default readiness probe settings
+const (
+	DefaultProbeTimeout  = 60 * time.Second
+	DefaultProbeInterval = time.Second
+)
+
+// String describes the probe, e.g. "tcp localhost:5432"
+func (p *ReadinessProbe) String() string {
+	switch {
+	case p.TCP != "":
+		return "tcp " + p.TCP
+	case p.HTTP != "":
+		return "http " + p.HTTP
+	default:
+		return "cmd '" + p.Cmd + "'"
+	}
+}
+
+// Durations returns the timeout and interval of the probe, with defaults for unset values
+func (p *ReadinessProbe) Durations() (timeout, interval time.Duration, err error) {
+	timeout, interval = DefaultProbeTimeout, DefaultProbeInterval
+	if p.Timeout != "" {
+		if timeout, err = time.ParseDuration(p.Timeout); err != nil {
+			return 0, 0, fmt.Errorf("invalid timeout: %s", p.Timeout)
+		}
+	}
+	if p.Interval != "" {
+		if interval, err = time.ParseDuration(p.Interval); err != nil {
+			return 0, 0, fmt.Errorf("invalid interval: %s", p.Interval)
+		}
+	}
+	return timeout, interval, nil
+}
+
+// validate checks that exactly one check is set and the durations are valid
+func (p *ReadinessProbe) validate() error {
+	checks := 0
+	for _, check := range []string{p.TCP, p.HTTP, p.Cmd} {
+		if check != "" {
+			checks++
+		}
+	}
+	if checks != 1 {
+		return fmt.Errorf("readiness probe must set exactly one of tcp, http and cmd")
+	}
+	_, _, err := p.Durations()
+	return err
+}
+
+// Restart policies of services
+const (
+	RestartNo        = "no"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// ScriptValue represents a script that can be either a string, an array of strings,
+// or an object with a "cmd" (string or array of strings) and additional settings
 type ScriptValue struct {
-	Single   string
-	Multiple []string
-	IsArray  bool
+	Single    string
+	Multiple  []string
+	IsArray   bool
+	DependsOn []string
+	// Cwd is a repository name of the application or a path relative to the application directory
+	Cwd string
+	// Env is merged over the application environment
+	Env map[string]string
+	// Timeout is a duration such as "5m" after which the script is killed
+	Timeout string
+	// Shell runs the commands instead of sh, e.g. "bash"
+	Shell string
+	// Parallel controls whether an array of commands runs in parallel (the default) or in order
+	Parallel *bool
+	// Ready marks a long-running script: scripts depending on it start once the probe succeeds
+	Ready *ReadinessProbe
+}
+
+// scriptObject is the object form of a script value
+type scriptObject struct {
+	Cmd       json.RawMessage   `json:"cmd,omitempty"`
+	DependsOn []string          `json:"depends_on,omitempty"`
+	Cwd       string            `json:"cwd,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Timeout   string            `json:"timeout,omitempty"`
+	Shell     string            `json:"shell,omitempty"`
+	Parallel  *bool             `json:"parallel,omitempty"`
+	Ready     *ReadinessProbe   `json:"ready,omitempty"`
 }
 
 // UnmarshalJSON implements custom JSON unmarshaling for ScriptValue
 func (sv *ScriptValue) UnmarshalJSON(data []byte) error {
+	// Try to unmarshal as string or array of strings first
+	if sv.unmarshalCommand(data) == nil {
+		return nil
+	}
+
+	// Try to unmarshal as object
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var obj scriptObject
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return fmt.Errorf("invalid script object: %v", err)
+		}
+		if obj.Cmd != nil {
+			if err := sv.unmarshalCommand(obj.Cmd); err != nil {
+				return fmt.Errorf("script cmd must be either a string or array of strings")
+			}
+		}
+		sv.DependsOn = obj.DependsOn
+		sv.Cwd = obj.Cwd
+		sv.Env = obj.Env
+		sv.Timeout = obj.Timeout
+		sv.Shell = obj.Shell
+		sv.Parallel = obj.Parallel
+		sv.Ready = obj.Ready
+		return nil
+	}
+
+	return fmt.Errorf("script value must be either a string, array of strings or object")
+}
+
+// unmarshalCommand unmarshals a command given as a string or array of strings
+func (sv *ScriptValue) unmarshalCommand(data []byte) error {
 	// Try to unmarshal as string first
 	var str string
 	if err := json.Unmarshal(data, &str); err == nil {
@@ -50,24 +244,67 @@ func (sv *ScriptValue) UnmarshalJSON(data []byte) error {
 
 	// Try to unmarshal as array of strings
 	var arr []string
-	if err := json.Unmarshal(data, &arr); err == nil {
-		sv.Multiple = arr
-		sv.IsArray = true
-		return nil
+	if err := json.Unmarshal(data, &arr); err != nil {
+		return err
 	}
-
-	return fmt.Errorf("script value must be either a string or array of strings")
+	sv.Multiple = arr
+	sv.IsArray = true
+	return nil
 }
 
 // MarshalJSON implements custom JSON marshaling for ScriptValue
 func (sv ScriptValue) MarshalJSON() ([]byte, error) {
+	cmd, err := sv.marshalCommand()
+	if err != nil || !sv.isObject() {
+		return cmd, err
+	}
+
+	obj := scriptObject{
+		DependsOn: sv.DependsOn,
+		Cwd:       sv.Cwd,
+		Env:       sv.Env,
+		Timeout:   sv.Timeout,
+		Shell:     sv.Shell,
+		Parallel:  sv.Parallel,
+		Ready:     sv.Ready,
+	}
+	if sv.HasCommand() {
+		obj.Cmd = cmd
+	}
+	return json.Marshal(obj)
+}
+
+// marshalCommand marshals the command as a string or array of strings
+func (sv ScriptValue) marshalCommand() ([]byte, error) {
 	if sv.IsArray {
 		return json.Marshal(sv.Multiple)
 	}
 	return json.Marshal(sv.Single)
 }
 
-// LoadConfig loads and validates the mess.json file
+// isObject reports whether the script uses settings that need the object form
+func (sv ScriptValue) isObject() bool {
+	return len(sv.DependsOn) > 0 || sv.Cwd != "" || len(sv.Env) > 0 ||
+		sv.Timeout != "" || sv.Shell != "" || sv.Parallel != nil || sv.Ready != nil
+}
+
+// IsParallel reports whether an array of commands runs in parallel
+func (sv ScriptValue) IsParallel() bool {
+	return sv.Parallel == nil || *sv.Parallel
+}
+
+// HasCommand reports whether the script runs any command itself, as opposed to
+// only grouping its dependencies
+func (sv ScriptValue) HasCommand() bool {
+	if sv.IsArray {
+		return len(sv.Multiple) > 0
+	}
+	return sv.Single != ""
+}
+
+// LoadConfig loads and validates the mess.json file, merged with its local override
+// file (mess.local.json) if there is one. Files ending in .yaml, .yml or .toml are read
+// as YAML or TOML
 func LoadConfig(configPath string) (*MessConfig, error) {
 	// If no path provided, try to find mess.json in current directory
 	if configPath == "" {
@@ -85,21 +322,83 @@ func LoadConfig(configPath string) (*MessConfig, error) {
 		return nil, fmt.Errorf("failed to read config file: %v", err)
 	}
 
-	// Parse JSON
+	// Parse the file in the format given by its extension
+	base, err := decodeFormat(FormatOf(configPath), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", parseProblem(displayPath(configPath, configPath), data, err))
+	}
+
+	// Upgrade files written by older versions of mess. Included and local override files
+	// without a version are taken to be of the same version as the base file. A copy is
+	// upgraded, so saving changes does not upgrade the file: that is what 'mess config
+	// migrate' is for
+	version, err := documentVersion(base, 0)
+	var migrated map[string]interface{}
+	if err == nil {
+		migrated, err = copyDocument(base)
+	}
+	if err == nil {
+		_, err = migrateDocument(migrated, 0)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", configPath, err)
+	}
+
+	// Add the included files, recording where every repository and application comes from
+	source := &configSource{path: displayPath(configPath, configPath), base: base, data: data, files: provenance{}}
+	absConfigPath, _ := filepath.Abs(configPath)
+	if source.fragments, err = loadIncludes(migrated, configPath, configPath, version, map[string]bool{absConfigPath: true}); err != nil {
+		return nil, err
+	}
+	doc := map[string]interface{}{"repos": migrated["repos"], "applications": migrated["applications"]}
+	source.files.extend(doc, source.path)
+	for _, frag := range source.fragments {
+		appendFragment(doc, frag)
+		source.files.extend(doc, frag.path)
+	}
+	doc = source.compose(migrated)
+
+	// Merge the local override file
+	localPath := LocalConfigPath(configPath)
+	doc, overlay, err := loadOverlay(doc, localPath, configPath, version)
+	if err != nil {
+		return nil, err
+	}
+	if overlay != nil {
+		source.local = append(source.local, *overlay)
+		source.files.extend(doc, overlay.path)
+	}
+
 	var config MessConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	encoded, err := json.Marshal(doc)
+	if err == nil {
+		err = json.Unmarshal(encoded, &config)
+	}
+	if err != nil {
+		// A value of the wrong type, which the schema check reports with its position
+		if problems := source.checkSchema(); len(problems) > 0 {
+			return nil, fmt.Errorf("invalid configuration: %w", problems.err())
+		}
 		return nil, fmt.Errorf("failed to parse config file: %v", err)
 	}
 
 	// Validate configuration
+	config.source = source
 	if err := ValidateConfig(&config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	// Remember what was loaded, to save only the changes
+	if source.snapshot, err = toDocument(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
 	}
 
 	return &config, nil
 }
 
-// SaveConfig saves the configuration to the specified file
+// SaveConfig saves the configuration to the specified file. For a configuration loaded
+// with LoadConfig, only the changes made since are written, to the base file: the content
+// of the local override file never ends up in it. The format is given by the extension
 func SaveConfig(config *MessConfig, configPath string) error {
 	// If no path provided, use mess.json in current directory
 	if configPath == "" {
@@ -112,10 +411,58 @@ func SaveConfig(config *MessConfig, configPath string) error {
 		return fmt.Errorf("failed to create directory: %v", err)
 	}
 
-	// Marshal to JSON with indentation
-	data, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal config: %v", err)
+	// Apply the changes to the base file
+	toSave := config
+	var snapshot, base map[string]interface{}
+	if config.source != nil {
+		var err error
+		if snapshot, err = toDocument(config); err != nil {
+			return fmt.Errorf("failed to marshal config: %v", err)
+		}
+		if base, err = config.source.apply(snapshot); err != nil {
+			return err
+		}
+		data, err := json.Marshal(base)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %v", err)
+		}
+		toSave = &MessConfig{}
+		if err := json.Unmarshal(data, toSave); err != nil {
+			return fmt.Errorf("failed to marshal config: %v", err)
+		}
+		// The base file must stay valid for everyone who does not have the override files
+		if len(config.source.local) > 0 {
+			withIncludes := &MessConfig{}
+			if data, err = json.Marshal(config.source.compose(base)); err == nil {
+				err = json.Unmarshal(data, withIncludes)
+			}
+			if err == nil {
+				err = ValidateConfig(withIncludes)
+			}
+			if err != nil {
+				return fmt.Errorf("cannot save %s: without %s it would be invalid: %v",
+					configPath, config.source.localPaths(), err)
+			}
+		}
+	}
+
+	// Edit JSON files in place, so that only the changed values are rewritten and the
+	// formatting and comments of the rest of the file are kept
+	var data []byte
+	if config.source != nil && FormatOf(configPath) == FormatJSON {
+		data = editedJSON(config.source.data, base)
+	}
+
+	// Otherwise marshal the whole file in its format
+	if data == nil {
+		var extensions map[string]interface{}
+		if config.source != nil {
+			extensions = extensionKeys(base)
+		}
+		var err error
+		if data, err = encodeFormat(FormatOf(configPath), toSave, extensions); err != nil {
+			return fmt.Errorf("failed to marshal config: %v", err)
+		}
 	}
 
 	// Write to file
@@ -123,49 +470,225 @@ func SaveConfig(config *MessConfig, configPath string) error {
 		return fmt.Errorf("failed to write config file: %v", err)
 	}
 
+	if config.source != nil {
+		config.source.base, config.source.snapshot, config.source.data = base, snapshot, data
+	}
 	return nil
 }
 
-// ValidateConfig validates the configuration structure
+// definedIn describes where two entries of the repos or applications list were defined,
+// e.g. " (defined in mess.json and repos/platform/mess.fragment.json)", if it is known
+func (config *MessConfig) definedIn(key string, first, second int) string {
+	if config.source == nil || second >= len(config.source.files[key]) {
+		return ""
+	}
+	files := config.source.files[key]
+	if files[first] == files[second] {
+		return fmt.Sprintf(" (defined twice in %s)", files[first])
+	}
+	return fmt.Sprintf(" (defined in %s and %s)", files[first], files[second])
+}
+
+// ValidateConfig validates the configuration structure. It returns a *ValidationError listing
+// every problem found, located in the files the configuration was loaded from
 func ValidateConfig(config *MessConfig) error {
+	// Keys that do not belong to the configuration are usually typos, e.g. clone_param
+	var problems problemList
+	if config.source != nil {
+		problems = config.source.checkSchema()
+	}
+
+	var semantic problemList
 	if config.Name == "" {
-		return fmt.Errorf("project name cannot be empty")
+		semantic.add([]pathElement{{key: "name"}}, "project name cannot be empty")
+	}
+
+	switch config.GitBackend {
+	case "", "exec", "go-git":
+	default:
+		semantic.add([]pathElement{{key: "git_backend"}}, "unknown git backend: %s (available: exec, go-git)", config.GitBackend)
 	}
 
 	// Validate repos
 	repoNames := make(map[string]bool)
-	for _, repo := range config.Repos {
+	repoIndex := make(map[string]int)
+	for i, repo := range config.Repos {
 		if repo.Name == "" {
-			return fmt.Errorf("repo name cannot be empty")
+			semantic.add(settingPath("repos", "", i, "name"), "repo name cannot be empty")
+			continue
 		}
 		if repo.URL == "" {
-			return fmt.Errorf("repo URL cannot be empty for repo: %s", repo.Name)
+			semantic.add(settingPath("repos", repo.Name, i, "url"), "repo URL cannot be empty for repo: %s", repo.Name)
 		}
 		if repoNames[repo.Name] {
-			return fmt.Errorf("duplicate repo name: %s", repo.Name)
+			semantic.add(settingPath("repos", repo.Name, i), "duplicate repo name: %s%s", repo.Name, config.definedIn("repos", repoIndex[repo.Name], i))
+			continue
+		}
+		pins := 0
+		for _, value := range []string{repo.Ref, repo.Branch, repo.Commit} {
+			if value != "" {
+				pins++
+			}
+		}
+		if pins > 1 {
+			semantic.add(settingPath("repos", repo.Name, i), "repo %s can only set one of ref, branch or commit", repo.Name)
 		}
 		repoNames[repo.Name] = true
+		repoIndex[repo.Name] = i
 	}
 
 	// Validate applications
 	appNames := make(map[string]bool)
-	for _, app := range config.Applications {
+	appIndex := make(map[string]int)
+	for i, app := range config.Applications {
 		if app.Name == "" {
-			return fmt.Errorf("application name cannot be empty")
+			semantic.add(settingPath("applications", "", i, "name"), "application name cannot be empty")
+			continue
 		}
 		if appNames[app.Name] {
-			return fmt.Errorf("duplicate application name: %s", app.Name)
+			semantic.add(settingPath("applications", app.Name, i), "duplicate application name: %s%s", app.Name, config.definedIn("applications", appIndex[app.Name], i))
+			continue
 		}
 		appNames[app.Name] = true
+		appIndex[app.Name] = i
 
 		// Validate that all referenced repos exist
-		for _, repoName := range app.Repos {
+		for j, repoName := range app.Repos {
 			if !repoNames[repoName] {
-				return fmt.Errorf("application %s references non-existent repo: %s", app.Name, repoName)
+				path := append(settingPath("applications", app.Name, i, "repos"), itemElement("", j))
+				semantic.add(path, "application %s references non-existent repo: %s", app.Name, repoName)
 			}
 		}
+
+		validateScripts(&app, i, &semantic)
+		validateServices(&app, i, &semantic)
+	}
+
+	if config.source != nil {
+		config.source.locate(semantic)
 	}
+	return append(problems, semantic...).err()
+}
 
+// validateScripts checks script settings and that script dependencies exist and do not form a cycle
+func validateScripts(app *ApplicationDefinition, index int, problems *problemList) {
+	names := make([]string, 0, len(app.Scripts))
+	for name := range app.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		script := app.Scripts[name]
+		if script.Timeout != "" {
+			if _, err := time.ParseDuration(script.Timeout); err != nil {
+				problems.add(settingPath("applications", app.Name, index, "scripts", name, "timeout"),
+					"script %s of application %s has an invalid timeout: %s", name, app.Name, script.Timeout)
+			}
+		}
+		if script.Ready != nil {
+			if err := script.Ready.validate(); err != nil {
+				problems.add(settingPath("applications", app.Name, index, "scripts", name, "ready"),
+					"script %s of application %s: %v", name, app.Name, err)
+			}
+		}
+		for _, dep := range script.DependsOn {
+			if _, exists := app.Scripts[dep]; !exists {
+				problems.add(settingPath("applications", app.Name, index, "scripts", name, "depends_on"),
+					"script %s of application %s depends on non-existent script: %s", name, app.Name, dep)
+			}
+		}
+	}
+
+	cycle := findCycle(names, func(name string) []string { return app.Scripts[name].DependsOn })
+	if cycle != nil {
+		problems.add(settingPath("applications", app.Name, index, "scripts", cycle[0], "depends_on"),
+			"application %s has a script dependency cycle: %s", app.Name, strings.Join(cycle, " -> "))
+	}
+}
+
+// validateServices checks the commands, restart policies, readiness probes and dependencies of an application's services
+func validateServices(app *ApplicationDefinition, index int, problems *problemList) {
+	names := make([]string, 0, len(app.Services))
+	for name := range app.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		service := app.Services[name]
+		if service.Cmd == "" {
+			problems.add(settingPath("applications", app.Name, index, "services", name, "cmd"),
+				"service %s of application %s has no cmd", name, app.Name)
+		}
+		switch service.Restart {
+		case "", RestartNo, RestartOnFailure, RestartAlways:
+		default:
+			problems.add(settingPath("applications", app.Name, index, "services", name, "restart"),
+				"service %s of application %s has an invalid restart policy: %s (available: %s, %s, %s)",
+				name, app.Name, service.Restart, RestartNo, RestartOnFailure, RestartAlways)
+		}
+		if service.Ready != nil {
+			if err := service.Ready.validate(); err != nil {
+				problems.add(settingPath("applications", app.Name, index, "services", name, "ready"),
+					"service %s of application %s: %v", name, app.Name, err)
+			}
+		}
+		for _, dep := range service.DependsOn {
+			if _, exists := app.Services[dep]; !exists {
+				problems.add(settingPath("applications", app.Name, index, "services", name, "depends_on"),
+					"service %s of application %s depends on non-existent service: %s", name, app.Name, dep)
+			}
+		}
+	}
+
+	cycle := findCycle(names, func(name string) []string { return app.Services[name].DependsOn })
+	if cycle != nil {
+		problems.add(settingPath("applications", app.Name, index, "services", cycle[0], "depends_on"),
+			"application %s has a service dependency cycle: %s", app.Name, strings.Join(cycle, " -> "))
+	}
+}
+
+// findCycle returns the first dependency cycle found, e.g. [a b a], or nil if there is none
+func findCycle(names []string, deps func(name string) []string) []string {
+	// Depth-first search, tracking the nodes on the current path to find back edges
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			return append(append([]string{}, path[start:]...), name)
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps(name) {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
 	return nil
 }
 
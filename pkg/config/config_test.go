@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveConfigDoesNotMigrate(t *testing.T) {
+	files := map[string]string{
+		"mess.json": `{"name": "test", "repos": [], "applications": []}`,
+		"mess.yaml": "name: test\nrepos: []\napplications: []\n",
+		"mess.toml": "name = \"test\"\nrepos = []\napplications = []\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if config.Version != CurrentVersion {
+				t.Errorf("loaded version = %d, want %d", config.Version, CurrentVersion)
+			}
+			config.Repos = append(config.Repos, RepoDefinition{Name: "api", URL: "https://example.com/api.git"})
+			if err := SaveConfig(config, configPath); err != nil {
+				t.Fatalf("SaveConfig() error = %v", err)
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "api") {
+				t.Errorf("saved file does not have the new repository:\n%s", data)
+			}
+			if strings.Contains(string(data), "version") {
+				t.Errorf("saving changes added the version to the file:\n%s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ConfigFileNames are the names of the config files searched for by FindConfig, in order
+// of preference when a directory has more than one
+var ConfigFileNames = []string{"mess.json", "mess.jsonc", "mess.yaml", "mess.yml", "mess.toml"}
+
+// FindConfig returns the path of the config file to use when none was given on the command
+// line: the MESS_CONFIG environment variable if it is set, otherwise the nearest mess.json,
+// mess.jsonc, mess.yaml, mess.yml or mess.toml in dir or one of its parent directories. It
+// returns "" if there is none
+func FindConfig(dir string) string {
+	if configPath := os.Getenv("MESS_CONFIG"); configPath != "" {
+		return configPath
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		for _, name := range ConfigFileNames {
+			configPath := filepath.Join(dir, name)
+			if info, err := os.Stat(configPath); err == nil && !info.IsDir() {
+				return configPath
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dotenvKey matches valid variable names in dotenv files, which must also be valid shell
+// variable names for 'mess env'
+var dotenvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadEnvFiles reads dotenv files in order, later files overriding earlier ones. Relative
+// paths are relative to the directory containing the config file, and missing files are skipped
+func LoadEnvFiles(files []string, configPath string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, file := range files {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(ProjectRoot(configPath), path)
+		}
+
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env file: %v", err)
+		}
+
+		values, err := ParseDotenv(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%v", file, err)
+		}
+		for key, value := range values {
+			env[key] = value
+		}
+	}
+	return env, nil
+}
+
+// ParseDotenv parses the contents of a dotenv file: KEY=value lines with an optional
+// "export " prefix, # comments, and single-quoted (literal) or double-quoted (with \n, \t, \"
+// and \\ escapes) values that may span multiple lines
+func ParseDotenv(data string) (map[string]string, error) {
+	env := make(map[string]string)
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found {
+			return nil, fmt.Errorf("%d: expected KEY=value", lineNumber)
+		}
+		if !dotenvKey.MatchString(key) {
+			return nil, fmt.Errorf("%d: invalid variable name: %q", lineNumber, key)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		if value == "" || (value[0] != '"' && value[0] != '\'') {
+			// Unquoted values end at a comment
+			if index := strings.Index(value, " #"); index >= 0 {
+				value = value[:index]
+			}
+			env[key] = strings.TrimSpace(value)
+			continue
+		}
+
+		// Quoted values may continue on the following lines
+		quote := value[0]
+		value = value[1:]
+		for {
+			if end := closingQuote(value, quote); end >= 0 {
+				rest := strings.TrimSpace(value[end+1:])
+				if rest != "" && !strings.HasPrefix(rest, "#") {
+					return nil, fmt.Errorf("%d: unexpected characters after quoted value: %s", lineNumber, rest)
+				}
+				value = value[:end]
+				break
+			}
+			i++
+			if i == len(lines) {
+				return nil, fmt.Errorf("%d: unterminated quoted value", lineNumber)
+			}
+			value += "\n" + lines[i]
+		}
+
+		if quote == '"' {
+			value = unescapeDotenv(value)
+		}
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// closingQuote returns the index of the quote that ends a quoted value, or -1.
+// Double quotes can be escaped with a backslash
+func closingQuote(value string, quote byte) int {
+	for i := 0; i < len(value); i++ {
+		switch {
+		case quote == '"' && value[i] == '\\':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeDotenv replaces the escape sequences of a double-quoted value
+func unescapeDotenv(value string) string {
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			result.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'n':
+			result.WriteByte('\n')
+		case 'r':
+			result.WriteByte('\r')
+		case 't':
+			result.WriteByte('\t')
+		case '"', '\\', '$':
+			result.WriteByte(value[i])
+		default:
+			result.WriteByte('\\')
+			result.WriteByte(value[i])
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{name: "empty", data: "", want: map[string]string{}},
+		{name: "plain values", data: "A=1\nB = two\n", want: map[string]string{"A": "1", "B": "two"}},
+		{name: "empty value", data: "EMPTY=\n", want: map[string]string{"EMPTY": ""}},
+		{name: "comments", data: "# comment\n\n  # indented\nA=1 # trailing\nB=x#y\n", want: map[string]string{"A": "1", "B": "x#y"}},
+		{name: "export prefix", data: "export A=1\n", want: map[string]string{"A": "1"}},
+		{name: "windows line endings", data: "A=1\r\nB=2\r\n", want: map[string]string{"A": "1", "B": "2"}},
+		{name: "equals sign in value", data: "URL=postgres://u:p@h/db?sslmode=disable\n", want: map[string]string{"URL": "postgres://u:p@h/db?sslmode=disable"}},
+		{name: "single quotes are literal", data: `A='x\ny $HOME # not a comment'`, want: map[string]string{"A": `x\ny $HOME # not a comment`}},
+		{name: "double quote escapes", data: `A="line\nnext\ttab \"q\" back\\slash \$ \x"`, want: map[string]string{"A": "line\nnext\ttab \"q\" back\\slash $ \\x"}},
+		{name: "comment after quoted value", data: `A="x" # comment`, want: map[string]string{"A": "x"}},
+		{name: "multiline value", data: "KEY=\"-----BEGIN-----\nabc\n-----END-----\"\nB=2\n", want: map[string]string{"KEY": "-----BEGIN-----\nabc\n-----END-----", "B": "2"}},
+		{name: "later values win", data: "A=1\nA=2\n", want: map[string]string{"A": "2"}},
+		{name: "missing equals sign", data: "A=1\nB\n", wantErr: "2: expected KEY=value"},
+		{name: "dotted name", data: "FOO.BAR=1\n", wantErr: `1: invalid variable name: "FOO.BAR"`},
+		{name: "name starting with a digit", data: "1A=1\n", wantErr: `1: invalid variable name: "1A"`},
+		{name: "unterminated quote", data: "A=1\nB=\"open\nstill open\n", wantErr: "2: unterminated quoted value"},
+		{name: "text after quote", data: `A="x" y`, wantErr: "1: unexpected characters after quoted value: y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDotenv(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("ParseDotenv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDotenv() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDotenv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEnvFiles(t *testing.T) {
+	configPath := writeProject(t, map[string]string{
+		".env":       "A=1\nB=1\n",
+		".env.local": "B=2\n",
+		"bad.env":    "FOO.BAR=1\n",
+	})
+
+	env, err := LoadEnvFiles([]string{".env", ".env.local", ".env.missing"}, configPath)
+	if err != nil {
+		t.Fatalf("LoadEnvFiles() error = %v", err)
+	}
+	if want := map[string]string{"A": "1", "B": "2"}; !reflect.DeepEqual(env, want) {
+		t.Errorf("LoadEnvFiles() = %v, want %v", env, want)
+	}
+
+	_, err = LoadEnvFiles([]string{filepath.Join(filepath.Dir(configPath), "bad.env")}, configPath)
+	if err == nil || !strings.HasSuffix(err.Error(), `bad.env:1: invalid variable name: "FOO.BAR"`) {
+		t.Fatalf("LoadEnvFiles() error = %v, want an invalid variable name in bad.env", err)
+	}
+}
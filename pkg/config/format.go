@@ -0,0 +1,305 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Supported config file formats
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// Formats lists the supported config file formats
+var Formats = []string{FormatJSON, FormatYAML, FormatTOML}
+
+// FormatOf returns the format of a config file from its extension: .yaml and .yml are YAML,
+// .toml is TOML and anything else, including .jsonc, is JSON
+func FormatOf(configPath string) string {
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// decodeFormat decodes a config file of the given format into a generic document.
+// Every format is decoded to the same values as JSON, so the rest of the package only
+// deals with one kind of document
+func decodeFormat(format string, data []byte) (map[string]interface{}, error) {
+	var value interface{}
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			// An empty file
+			value = map[string]interface{}{}
+		}
+	case FormatTOML:
+		var table map[string]interface{}
+		if _, err := toml.Decode(string(data), &table); err != nil {
+			return nil, err
+		}
+		value = table
+	default:
+		// Comments and trailing commas are allowed, as in editor settings files
+		return decodeDocument(stripJSONC(data))
+	}
+
+	if _, ok := value.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("config must be a %s mapping", strings.ToUpper(format))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(data)
+}
+
+// encodeFormat encodes a configuration, or a document, in the given format, followed by the
+// extension keys, which are not part of the configuration. JSON and YAML keep the order of the
+// fields of the configuration; TOML writes keys in alphabetical order
+func encodeFormat(format string, value interface{}, extensions map[string]interface{}) ([]byte, error) {
+	switch format {
+	case FormatYAML:
+		// JSON is valid YAML: parsing it as a node tree keeps the order of the keys
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		for _, key := range sortedKeys(extensions) {
+			var keyNode, valueNode yaml.Node
+			keyNode.SetString(key)
+			data, err := json.Marshal(extensions[key])
+			if err == nil {
+				err = yaml.Unmarshal(data, &valueNode)
+			}
+			if err != nil {
+				return nil, err
+			}
+			node.Content[0].Content = append(node.Content[0].Content, &keyNode, valueNode.Content[0])
+		}
+		blockStyle(&node)
+
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case FormatTOML:
+		doc, err := toDocument(value)
+		if err != nil {
+			return nil, err
+		}
+		for key, extension := range extensions {
+			doc[key] = extension
+		}
+		table, err := tomlValue(doc, nil)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		encoder := toml.NewEncoder(&buf)
+		encoder.Indent = ""
+		if err := encoder.Encode(table); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	default:
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil || len(extensions) == 0 {
+			return data, err
+		}
+		// Add the extension keys before the closing brace of the object
+		var buf bytes.Buffer
+		buf.Write(bytes.TrimSuffix(data, []byte("\n}")))
+		for _, key := range sortedKeys(extensions) {
+			encodedKey, _ := json.Marshal(key)
+			encodedValue, err := json.MarshalIndent(extensions[key], "  ", "  ")
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&buf, ",\n  %s: %s", encodedKey, encodedValue)
+		}
+		buf.WriteString("\n}")
+		return buf.Bytes(), nil
+	}
+}
+
+// extensionKeys returns the top-level keys of a document that start with the extension prefix
+func extensionKeys(doc map[string]interface{}) map[string]interface{} {
+	extensions := map[string]interface{}{}
+	for key, value := range doc {
+		if strings.HasPrefix(key, extensionPrefix) {
+			extensions[key] = value
+		}
+	}
+	return extensions
+}
+
+// blockStyle switches a node tree parsed from JSON to the usual YAML style: block collections,
+// plain scalars where they are unambiguous and literal blocks for multi-line strings
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		if strings.Contains(node.Value, "\n") {
+			node.Style = yaml.LiteralStyle
+		} else if quoted, err := yaml.Marshal(node.Value); err == nil && (quoted[0] == '"' || quoted[0] == '\'') {
+			// Strings such as "yes" or "8080" that other YAML parsers would read as another type
+			node.Style = yaml.DoubleQuotedStyle
+		}
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// tomlValue converts a document value for the TOML encoder, which has no null and writes
+// json.Number values as strings
+func tomlValue(value interface{}, path []string) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("%s: TOML has no null value", strings.Join(path, "."))
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case map[string]interface{}:
+		table := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			converted, err := tomlValue(child, append(path, key))
+			if err != nil {
+				return nil, err
+			}
+			table[key] = converted
+		}
+		return table, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, child := range v {
+			converted, err := tomlValue(child, append(path, fmt.Sprintf("%d", i)))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
+// backupSuffix is added to the names of the files ConvertConfig replaces
+const backupSuffix = ".bak"
+
+// ConvertConfig rewrites a config file, and its local override file if there is one, in
+// another format next to the original. The original files are renamed with a .bak suffix,
+// as comments are not carried over. It returns the path of the new config file
+func ConvertConfig(configPath, format string) (string, error) {
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+	if !isFormat(format) {
+		return "", fmt.Errorf("unknown format: %s (expected one of %s)", format, strings.Join(Formats, ", "))
+	}
+	if FormatOf(configPath) == format {
+		return "", fmt.Errorf("%s is already a %s file", configPath, strings.ToUpper(format))
+	}
+	newPath := strings.TrimSuffix(configPath, filepath.Ext(configPath)) + "." + format
+
+	// Files to convert, from their original to their new path
+	files := [][2]string{{configPath, newPath}}
+	if localPath := LocalConfigPath(configPath); fileExists(localPath) {
+		files = append(files, [2]string{localPath, LocalConfigPath(newPath)})
+	}
+
+	converted := make([][]byte, len(files))
+	for i, file := range files {
+		for _, path := range []string{file[1], file[0] + backupSuffix} {
+			if fileExists(path) {
+				return "", fmt.Errorf("%s already exists", path)
+			}
+		}
+		data, err := os.ReadFile(file[0])
+		if err != nil {
+			return "", fmt.Errorf("failed to read config file: %v", err)
+		}
+		doc, err := decodeFormat(FormatOf(file[0]), data)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse config file %s: %v", file[0], err)
+		}
+
+		// The base file goes through the configuration to keep its fields in order. The local
+		// override file only has some of the fields, which must stay as they are
+		var value interface{} = doc
+		var extensions map[string]interface{}
+		if i == 0 {
+			extensions = extensionKeys(doc)
+			var config MessConfig
+			if data, err = json.Marshal(doc); err == nil {
+				err = json.Unmarshal(data, &config)
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to parse config file %s: %v", file[0], err)
+			}
+			value = &config
+		}
+		if converted[i], err = encodeFormat(format, value, extensions); err != nil {
+			return "", fmt.Errorf("failed to convert %s: %v", file[0], err)
+		}
+	}
+
+	for i, file := range files {
+		if err := os.WriteFile(file[1], converted[i], 0644); err != nil {
+			return "", fmt.Errorf("failed to write config file: %v", err)
+		}
+	}
+	for _, file := range files {
+		if err := os.Rename(file[0], file[0]+backupSuffix); err != nil {
+			return "", fmt.Errorf("failed to rename %s: %v", file[0], err)
+		}
+	}
+	return newPath, nil
+}
+
+// isFormat reports whether format is a supported config file format
+func isFormat(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// fileExists reports whether a file exists at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
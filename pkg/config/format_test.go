@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// roundTripConfig uses every form of script value and keys that are easy to lose
+const roundTripConfig = `{
+  "$schema": "https://example.com/mess.schema.json",
+  "version": 1,
+  "name": "shop",
+  "x-team": {"owner": "platform", "oncall": ["a", "b"]},
+  "env": {"LOG_LEVEL": "debug"},
+  "repos": [
+    {"name": "api", "url": "https://example.com/api.git", "clone_params": ["--depth=1"], "branch": "main"},
+    {"name": "web", "url": "https://example.com/web.git", "env": {"NODE_ENV": "development"}}
+  ],
+  "applications": [
+    {
+      "name": "store",
+      "repos": ["api", "web"],
+      "scripts": {
+        "install": "npm install",
+        "lint": ["npm run lint", "go vet ./..."],
+        "build": {"cmd": ["make api", "make web"], "parallel": false, "depends_on": ["install"], "timeout": "5m"},
+        "serve": {"cmd": "make serve", "cwd": "api", "env": {"PORT": "8080"}, "ready": {"http": "http://localhost:8080/health", "interval": "2s"}},
+        "all": {"depends_on": ["build", "lint"]}
+      },
+      "services": {
+        "db": {"cmd": "postgres -D data", "restart": "on-failure", "ready": {"tcp": "localhost:5432"}}
+      }
+    }
+  ]
+}
+`
+
+// loadDocument loads a config file and returns it as a document, to compare configurations
+func loadDocument(t *testing.T, configPath string) map[string]interface{} {
+	t.Helper()
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig(%s) error = %v", filepath.Base(configPath), err)
+	}
+	doc, err := toDocument(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestConvertConfigRoundTrip(t *testing.T) {
+	for _, formats := range [][]string{
+		{FormatYAML, FormatJSON},
+		{FormatTOML, FormatJSON},
+		{FormatYAML, FormatTOML, FormatJSON},
+		{FormatTOML, FormatYAML, FormatJSON},
+	} {
+		t.Run(strings.Join(formats, "-"), func(t *testing.T) {
+			configPath := writeProject(t, map[string]string{
+				"mess.json":       roundTripConfig,
+				"mess.local.json": `{"env": {"LOG_LEVEL": "trace"}, "applications": [{"name": "store", "env": {"DEBUG": "1"}}]}`,
+			})
+			want := loadDocument(t, configPath)
+
+			path := configPath
+			for _, format := range formats {
+				newPath, err := ConvertConfig(path, format)
+				if err != nil {
+					t.Fatalf("ConvertConfig(%s, %s) error = %v", filepath.Base(path), format, err)
+				}
+				if got := loadDocument(t, newPath); !reflect.DeepEqual(got, want) {
+					t.Fatalf("%s after conversion =\n%v\nwant\n%v", filepath.Base(newPath), got, want)
+				}
+				path = newPath
+			}
+
+			// The extension keys are kept, and the originals are renamed
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "x-team") {
+				t.Errorf("extension key x-team was lost:\n%s", data)
+			}
+			for _, backup := range []string{"mess.json.bak", "mess.local.json.bak"} {
+				data, err := os.ReadFile(filepath.Join(filepath.Dir(configPath), backup))
+				if err != nil {
+					t.Errorf("original file was not kept: %v", err)
+				} else if backup == "mess.json.bak" && string(data) != roundTripConfig {
+					t.Errorf("%s differs from the original file", backup)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		format  string
+		wantErr string
+	}{
+		{name: "unknown format", format: "ini", wantErr: "unknown format: ini"},
+		{name: "same format", format: FormatJSON, wantErr: "mess.json is already a JSON file"},
+		{name: "target exists", files: map[string]string{"mess.yaml": "name: other\n"}, format: FormatYAML, wantErr: "mess.yaml already exists"},
+		{name: "backup exists", files: map[string]string{"mess.json.bak": "{}"}, format: FormatYAML, wantErr: "mess.json.bak already exists"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{"mess.json": roundTripConfig}
+			for name, content := range tt.files {
+				files[name] = content
+			}
+			configPath := writeProject(t, files)
+
+			_, err := ConvertConfig(configPath, tt.format)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ConvertConfig() error = %v, want %q", err, tt.wantErr)
+			}
+			if data, err := os.ReadFile(configPath); err != nil || string(data) != roundTripConfig {
+				t.Errorf("mess.json changed after a failed conversion: %v", err)
+			}
+		})
+	}
+}
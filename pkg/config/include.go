@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sourceFile is a file the configuration is loaded from, other than the base config file:
+// an included file, which adds repositories and applications, or a local override file
+type sourceFile struct {
+	// path is the path of the file, relative to the project root
+	path string
+	doc  map[string]interface{}
+	data []byte
+}
+
+// fragmentKeys are the keys an included file may set, besides extension keys
+var fragmentKeys = map[string]bool{"$schema": true, "version": true, "include": true, "repos": true, "applications": true}
+
+// loadIncludes loads the files listed in the include setting of doc, and the files they
+// include in turn. Relative paths are relative to the directory of the including file.
+// A missing file inside a repository that is not cloned yet is skipped, so the repository
+// can be cloned first. Files without a version are migrated from the given version
+func loadIncludes(doc map[string]interface{}, docPath string, configPath string, version int, seen map[string]bool) ([]sourceFile, error) {
+	includes, err := includeList(doc, docPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var fragments []sourceFile
+	for _, include := range includes {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(docPath), path)
+		}
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("%s: include cycle through %s", displayPath(docPath, configPath), displayPath(path, configPath))
+		}
+
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) && inUnclonedRepository(path, configPath) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to read included file: %v", displayPath(docPath, configPath), err)
+		}
+		fragmentDoc, err := decodeFormat(FormatOf(path), data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", parseProblem(displayPath(path, configPath), data, err))
+		}
+		if _, err := migrateDocument(fragmentDoc, version); err != nil {
+			return nil, fmt.Errorf("%s: %v", displayPath(path, configPath), err)
+		}
+		for _, key := range sortedKeys(fragmentDoc) {
+			if !fragmentKeys[key] && !strings.HasPrefix(key, extensionPrefix) {
+				return nil, fmt.Errorf("%s: included files can only set version, include, repos and applications, not %s", displayPath(path, configPath), key)
+			}
+		}
+
+		fragments = append(fragments, sourceFile{path: displayPath(path, configPath), doc: fragmentDoc, data: data})
+
+		seen[path] = true
+		nested, err := loadIncludes(fragmentDoc, path, configPath, version, seen)
+		delete(seen, path)
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, nested...)
+	}
+	return fragments, nil
+}
+
+// includeList returns the include setting of a document
+func includeList(doc map[string]interface{}, docPath string) ([]string, error) {
+	value, exists := doc["include"]
+	if !exists || value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: include must be a list of file paths", docPath)
+	}
+	includes := make([]string, 0, len(list))
+	for _, element := range list {
+		include, ok := element.(string)
+		if !ok || include == "" {
+			return nil, fmt.Errorf("%s: include must be a list of file paths", docPath)
+		}
+		includes = append(includes, include)
+	}
+	return includes, nil
+}
+
+// inUnclonedRepository reports whether path is inside the directory of a repository that
+// has not been cloned yet
+func inUnclonedRepository(path string, configPath string) bool {
+	reposDir := filepath.Join(ProjectRoot(configPath), "repos")
+	rel, err := filepath.Rel(reposDir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	repoName := strings.Split(rel, string(filepath.Separator))[0]
+	_, err = os.Stat(RepositoryDir(repoName, configPath))
+	return os.IsNotExist(err)
+}
+
+// displayPath returns path relative to the project root when it is inside the project
+func displayPath(path string, configPath string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(ProjectRoot(configPath), abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// appendFragment adds the repositories and applications of a fragment to a document.
+// They are appended rather than merged, so ValidateConfig reports names defined twice
+func appendFragment(doc map[string]interface{}, frag sourceFile) {
+	for _, key := range []string{"repos", "applications"} {
+		list, _ := frag.doc[key].([]interface{})
+		if len(list) == 0 {
+			continue
+		}
+		existing, _ := doc[key].([]interface{})
+		doc[key] = append(append([]interface{}{}, existing...), list...)
+	}
+}
+
+// provenance records the file each repository and application was defined in, by position
+// in the repos and applications lists
+type provenance map[string][]string
+
+// extend records file as the origin of the elements of the lists of doc that have no origin yet
+func (p provenance) extend(doc map[string]interface{}, file string) {
+	for _, key := range []string{"repos", "applications"} {
+		list, _ := doc[key].([]interface{})
+		for len(p[key]) < len(list) {
+			p[key] = append(p[key], file)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadIncludes(t *testing.T) {
+	configPath := writeProject(t, map[string]string{
+		"mess.json": `{
+  "name": "test",
+  "include": ["teams/web.json", "teams/data.yaml"],
+  "repos": [{"name": "base", "url": "https://example.com/base.git"}],
+  "applications": []
+}`,
+		"teams/web.json": `{
+  "include": ["shared/tools.toml"],
+  "repos": [{"name": "web", "url": "https://example.com/web.git"}],
+  "applications": [{"name": "shop", "repos": ["web", "tools", "db"], "scripts": {}}]
+}`,
+		"teams/shared/tools.toml": `[[repos]]
+name = "tools"
+url = "https://example.com/tools.git"
+`,
+		"teams/data.yaml": `repos:
+  - name: db
+    url: https://example.com/db.git
+`,
+	})
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	// Included files are added depth first, in the order they are listed
+	var names []string
+	for _, repo := range config.Repos {
+		names = append(names, repo.Name)
+	}
+	if want := []string{"base", "web", "tools", "db"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("repos = %v, want %v", names, want)
+	}
+
+	wantFiles := provenance{
+		"repos":        {"mess.json", filepath.Join("teams", "web.json"), filepath.Join("teams", "shared", "tools.toml"), filepath.Join("teams", "data.yaml")},
+		"applications": {filepath.Join("teams", "web.json")},
+	}
+	if !reflect.DeepEqual(config.source.files, wantFiles) {
+		t.Errorf("provenance = %v, want %v", config.source.files, wantFiles)
+	}
+
+	// Repositories defined in an included file are changed there
+	config.Repos[1].Branch = "develop"
+	err = SaveConfig(config, configPath)
+	if want := "cannot save changes to repos[web].branch: it comes from " + filepath.Join("teams", "web.json") + ", edit that file instead"; err == nil || err.Error() != want {
+		t.Errorf("SaveConfig() error = %v, want %q", err, want)
+	}
+}
+
+func TestLoadIncludesErrors(t *testing.T) {
+	const base = `{"name": "test", "include": ["teams/a.json"], "repos": [], "applications": []}`
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "cycle",
+			files:   map[string]string{"mess.json": base, "teams/a.json": `{"include": ["b.json"]}`, "teams/b.json": `{"include": ["a.json"]}`},
+			wantErr: filepath.Join("teams", "b.json") + ": include cycle through " + filepath.Join("teams", "a.json"),
+		},
+		{
+			name:    "cycle through the config file",
+			files:   map[string]string{"mess.json": base, "teams/a.json": `{"include": ["../mess.json"]}`},
+			wantErr: filepath.Join("teams", "a.json") + ": include cycle through mess.json",
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"mess.json": base},
+			wantErr: "mess.json: failed to read included file",
+		},
+		{
+			name:    "setting that a fragment cannot set",
+			files:   map[string]string{"mess.json": base, "teams/a.json": `{"name": "other"}`},
+			wantErr: filepath.Join("teams", "a.json") + ": included files can only set version, include, repos and applications, not name",
+		},
+		{
+			name:    "include is not a list",
+			files:   map[string]string{"mess.json": `{"name": "test", "include": "teams/a.json", "repos": [], "applications": []}`},
+			wantErr: "include must be a list of file paths",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeProject(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadIncludesFromUnclonedRepository(t *testing.T) {
+	configPath := writeProject(t, map[string]string{"mess.json": `{
+  "name": "test",
+  "include": ["repos/platform/mess.fragment.json"],
+  "repos": [{"name": "platform", "url": "https://example.com/platform.git"}],
+  "applications": []
+}`})
+
+	// The repository is not cloned yet, so its fragment is skipped
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() before clone error = %v", err)
+	}
+	if len(config.Repos) != 1 {
+		t.Errorf("repos before clone = %v, want only platform", config.Repos)
+	}
+
+	// Once it is cloned, its fragment has to exist
+	repoDir := RepositoryDir("platform", configPath)
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "failed to read included file") {
+		t.Fatalf("LoadConfig() with the fragment missing from the clone error = %v", err)
+	}
+
+	fragment := `{"repos": [{"name": "platform-tools", "url": "https://example.com/tools.git"}]}`
+	if err := os.WriteFile(filepath.Join(repoDir, "mess.fragment.json"), []byte(fragment), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err = LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() after clone error = %v", err)
+	}
+	if len(config.Repos) != 2 || config.Repos[1].Name != "platform-tools" {
+		t.Errorf("repos after clone = %v, want platform and platform-tools", config.Repos)
+	}
+}
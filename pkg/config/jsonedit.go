@@ -0,0 +1,445 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// editedJSON returns the content of a JSON file changed in place to hold the expected
+// document, or nil if that is not possible, in which case the whole file has to be written
+// again. Only the values that differ are rewritten
+func editedJSON(data []byte, expected map[string]interface{}) []byte {
+	if data == nil {
+		return nil
+	}
+	current, err := decodeFormat(FormatJSON, data)
+	if err != nil {
+		return nil
+	}
+	edited, err := editJSON(data, diffDocuments(current, expected, nil, nil))
+	if err != nil {
+		return nil
+	}
+	// Check the result, in case an edit did not do what was expected
+	if doc, err := decodeFormat(FormatJSON, edited); err != nil || !reflect.DeepEqual(doc, expected) {
+		return nil
+	}
+	return edited
+}
+
+// editJSON applies patch operations to the text of a JSON or JSONC file. Only the values they
+// change are rewritten: the formatting, key order and comments of the rest of the file are kept
+func editJSON(data []byte, ops []patchOp) ([]byte, error) {
+	for _, op := range ops {
+		var err error
+		if data, err = editJSONValue(data, op); err != nil {
+			return nil, fmt.Errorf("cannot edit %s: %v", describePath(op.path), err)
+		}
+	}
+	return data, nil
+}
+
+// jsonEntry is a member of an object or an element of an array
+type jsonEntry struct {
+	// start is the offset of the key of a member, or of the element
+	start int
+	value *jsonNode
+}
+
+// entries returns the members or elements of an object or array node
+func (n *jsonNode) entries() []jsonEntry {
+	var entries []jsonEntry
+	for _, member := range n.members {
+		entries = append(entries, jsonEntry{start: member.keyStart, value: member.value})
+	}
+	for _, item := range n.items {
+		entries = append(entries, jsonEntry{start: item.start, value: item})
+	}
+	return entries
+}
+
+// jsonEditor edits the text of a JSON file. stripped is the text with its comments blanked
+// out, used to find tokens at the same offsets
+type jsonEditor struct {
+	data     []byte
+	stripped []byte
+	// unit is the indentation of one level
+	unit string
+}
+
+// editJSONValue applies one operation to the text of a JSON file
+func editJSONValue(data []byte, op patchOp) ([]byte, error) {
+	e := &jsonEditor{data: data, stripped: blankJSONC(data, false)}
+	node, err := parseJSON(e.stripped)
+	if err != nil {
+		return nil, err
+	}
+	if len(op.path) == 0 {
+		return nil, fmt.Errorf("cannot replace the whole config document")
+	}
+	e.unit = e.indentUnit(node)
+
+	t := reflect.TypeOf(MessConfig{})
+	for i, element := range op.path {
+		last := i == len(op.path)-1
+		switch node.kind {
+		case '{':
+			index := -1
+			for j, member := range node.members {
+				if member.key == element.key {
+					index = j
+				}
+			}
+			switch {
+			case index < 0 && op.remove:
+				return data, nil
+			case index < 0:
+				return e.insert(node, element.key, buildValue(op.value, op.path[i+1:]), t), nil
+			case last && op.remove:
+				return e.remove(node, index), nil
+			case last:
+				return e.replace(node.members[index].value, op.value, jsonChildType(t, element)), nil
+			}
+			node = node.members[index].value
+
+		case '[':
+			index := listIndex(len(node.items), func(j int) string {
+				if name := node.items[j].member("name"); name != nil {
+					return name.text
+				}
+				return ""
+			}, element)
+			switch {
+			case index < 0 && op.remove:
+				return data, nil
+			case index < 0 && last:
+				return e.insert(node, "", op.value, t), nil
+			case index < 0:
+				return nil, fmt.Errorf("%s is not defined in the file", describePath(op.path[:i+1]))
+			case last && op.remove:
+				return e.remove(node, index), nil
+			case last:
+				return e.replace(node.items[index], op.value, jsonChildType(t, element)), nil
+			}
+			node = node.items[index]
+
+		default:
+			// A value where an object or array is needed, e.g. "scripts": null
+			if op.remove {
+				return data, nil
+			}
+			return e.replace(node, buildValue(op.value, op.path[i:]), t), nil
+		}
+		t = jsonChildType(t, element)
+	}
+	return data, nil
+}
+
+// buildValue returns the value to set so that value ends up at path below it, creating the
+// objects and named lists in between
+func buildValue(value interface{}, path []pathElement) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+	inner := buildValue(value, path[1:])
+	if path[0].named {
+		return []interface{}{inner}
+	}
+	return map[string]interface{}{path[0].key: inner}
+}
+
+// replace replaces a value, keeping the style of the old value: single-line arrays and objects
+// stay on one line
+func (e *jsonEditor) replace(node *jsonNode, value interface{}, t reflect.Type) []byte {
+	inline := (node.kind == '{' || node.kind == '[') && len(node.entries()) > 0 && e.sameLine(node.start, node.end)
+	text := e.render(value, t, e.lineIndent(node.start), inline)
+	return e.splice(node.start, node.end, text)
+}
+
+// insert adds a member to an object, or an element to the end of an array. Members of the
+// configuration types are placed in the order of the fields, other members are appended
+func (e *jsonEditor) insert(container *jsonNode, key string, value interface{}, t reflect.Type) []byte {
+	entries := container.entries()
+	if len(entries) == 0 {
+		var empty interface{} = []interface{}{value}
+		if container.kind == '{' {
+			empty = map[string]interface{}{key: value}
+		}
+		return e.replace(container, empty, t)
+	}
+
+	childType := jsonChildType(t, pathElement{key: key, named: container.kind == '['})
+	after := len(entries) - 1
+	if order, ok := jsonKeyOrder(t, key); ok && container.kind == '{' {
+		after = -1
+		best := -1
+		for i, member := range container.members {
+			if memberOrder, _ := jsonKeyOrder(t, member.key); memberOrder < order && memberOrder >= best {
+				after, best = i, memberOrder
+			}
+		}
+	}
+
+	inline := e.sameLine(container.start, container.end)
+	indent := e.lineIndent(entries[0].start)
+	text := e.render(value, childType, indent, inline)
+	if container.kind == '{' {
+		text = quoteKey(key) + ": " + text
+	}
+
+	if inline {
+		if after < 0 {
+			return e.splice(entries[0].start, entries[0].start, text+", ")
+		}
+		return e.splice(entries[after].value.end, entries[after].value.end, ", "+text)
+	}
+
+	if after < 0 {
+		start := entries[0].start
+		if lineStart := e.lineStart(start); e.blank(lineStart, start) {
+			return e.splice(lineStart, lineStart, indent+text+",\n")
+		}
+		return e.splice(start, start, text+", ")
+	}
+
+	// Insert after the line of the previous entry, so that a comment at its end stays there
+	end := entries[after].value.end
+	comma := e.next(end)
+	hasComma := comma < len(e.stripped) && e.stripped[comma] == ','
+	position := end
+	if hasComma {
+		position = comma + 1
+	}
+	if lineEnd := e.lineEnd(position); e.blank(position, lineEnd) {
+		position = lineEnd
+	}
+	if after < len(entries)-1 || hasComma {
+		// Another entry follows, or the file uses trailing commas
+		return e.splice(position, position, "\n"+indent+text+",")
+	}
+	data := e.splice(position, position, "\n"+indent+text)
+	return append(append(append([]byte{}, data[:end]...), ','), data[end:]...)
+}
+
+// remove removes a member of an object or an element of an array, with the comment lines
+// just above it
+func (e *jsonEditor) remove(container *jsonNode, index int) []byte {
+	entries := container.entries()
+	if len(entries) == 1 {
+		empty := "[]"
+		if container.kind == '{' {
+			empty = "{}"
+		}
+		return e.splice(container.start, container.end, empty)
+	}
+
+	entry := entries[index]
+	last := index == len(entries)-1
+	start, end := entry.start, entry.value.end
+	comma := e.next(end)
+	hasComma := comma < len(e.stripped) && e.stripped[comma] == ','
+	if hasComma {
+		end = comma + 1
+	}
+
+	lineStart := e.lineStart(start)
+	if !e.sameLine(container.start, container.end) && e.blank(lineStart, start) && e.blank(end, e.lineEnd(end)) {
+		// The entry is on lines of its own: remove them
+		start = lineStart
+		for start > 0 {
+			previous := e.lineStart(start - 1)
+			if !strings.HasPrefix(strings.TrimSpace(string(e.data[previous:start])), "//") || previous <= container.start {
+				break
+			}
+			start = previous
+		}
+		end = e.lineEnd(end)
+		if end < len(e.data) {
+			end++
+		}
+	} else if !last {
+		end = entries[index+1].start
+	} else {
+		// The separator before the entry goes with it
+		return e.splice(entries[index-1].value.end, end, "")
+	}
+
+	if last && !hasComma {
+		// Remove the comma of the previous entry, which is now the last one
+		previousEnd := entries[index-1].value.end
+		if previousComma := e.next(previousEnd); previousComma < start && e.stripped[previousComma] == ',' {
+			data := e.splice(start, end, "")
+			return append(append([]byte{}, data[:previousComma]...), data[previousComma+1:]...)
+		}
+	}
+	return e.splice(start, end, "")
+}
+
+// splice returns the text with the range [start, end) replaced
+func (e *jsonEditor) splice(start, end int, text string) []byte {
+	var buf bytes.Buffer
+	buf.Write(e.data[:start])
+	buf.WriteString(text)
+	buf.Write(e.data[end:])
+	return buf.Bytes()
+}
+
+// next returns the offset of the next token at or after offset
+func (e *jsonEditor) next(offset int) int {
+	for offset < len(e.stripped) && isJSONSpace(e.stripped[offset]) {
+		offset++
+	}
+	return offset
+}
+
+// blank reports whether the range [start, end) only has whitespace and comments
+func (e *jsonEditor) blank(start, end int) bool {
+	return len(bytes.TrimSpace(e.stripped[start:end])) == 0
+}
+
+// sameLine reports whether two offsets are on the same line
+func (e *jsonEditor) sameLine(start, end int) bool {
+	return !bytes.Contains(e.data[start:end], []byte("\n"))
+}
+
+// lineStart returns the offset of the start of the line containing offset
+func (e *jsonEditor) lineStart(offset int) int {
+	return bytes.LastIndexByte(e.data[:offset], '\n') + 1
+}
+
+// lineEnd returns the offset of the end of the line containing offset, before the newline
+func (e *jsonEditor) lineEnd(offset int) int {
+	if end := bytes.IndexByte(e.data[offset:], '\n'); end >= 0 {
+		return offset + end
+	}
+	return len(e.data)
+}
+
+// lineIndent returns the whitespace at the start of the line containing offset
+func (e *jsonEditor) lineIndent(offset int) string {
+	start := e.lineStart(offset)
+	end := start
+	for end < len(e.data) && (e.data[end] == ' ' || e.data[end] == '\t') {
+		end++
+	}
+	return string(e.data[start:end])
+}
+
+// indentUnit returns the indentation of one level used by the file: the indentation of the
+// first member of the top-level object, or two spaces
+func (e *jsonEditor) indentUnit(root *jsonNode) string {
+	if entries := root.entries(); len(entries) > 0 && !e.sameLine(root.start, entries[0].start) {
+		if indent := e.lineIndent(entries[0].start); indent != "" {
+			return strings.TrimPrefix(indent, e.lineIndent(root.start))
+		}
+	}
+	return "  "
+}
+
+// render formats a value as JSON, starting at the given indentation. Objects of the
+// configuration types have their keys in the order of the fields
+func (e *jsonEditor) render(value interface{}, t reflect.Type, indent string, inline bool) string {
+	var parts []string
+	open, close := "[", "]"
+	switch v := value.(type) {
+	case map[string]interface{}:
+		open, close = "{", "}"
+		for _, key := range orderedKeys(v, t) {
+			parts = append(parts, quoteKey(key)+": "+e.render(v[key], jsonChildType(t, pathElement{key: key}), indent+e.unit, inline))
+		}
+	case []interface{}:
+		for _, element := range v {
+			parts = append(parts, e.render(element, jsonChildType(t, pathElement{named: true}), indent+e.unit, inline))
+		}
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	switch {
+	case len(parts) == 0:
+		return open + close
+	case inline:
+		return open + strings.Join(parts, ", ") + close
+	default:
+		inner := indent + e.unit
+		return open + "\n" + inner + strings.Join(parts, ",\n"+inner) + "\n" + indent + close
+	}
+}
+
+// quoteKey formats an object key
+func quoteKey(key string) string {
+	data, _ := json.Marshal(key)
+	return string(data)
+}
+
+// orderedKeys returns the keys of an object in the order of the fields of its type, followed
+// by the keys that are not fields, in alphabetical order
+func orderedKeys(object map[string]interface{}, t reflect.Type) []string {
+	keys := sortedKeys(object)
+	sort.SliceStable(keys, func(i, j int) bool {
+		first, _ := jsonKeyOrder(t, keys[i])
+		second, _ := jsonKeyOrder(t, keys[j])
+		return first < second
+	})
+	return keys
+}
+
+// jsonStructType returns the struct type whose fields are the keys of an object of type t,
+// or nil if t is not a struct
+func jsonStructType(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(ScriptValue{}) {
+		t = reflect.TypeOf(scriptObject{})
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// jsonKeyOrder returns the index of the field of a struct type with the given key, or the
+// number of fields if there is none. ok is false if t is not a struct type
+func jsonKeyOrder(t reflect.Type, key string) (order int, ok bool) {
+	t = jsonStructType(t)
+	if t == nil {
+		return 0, false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if jsonKey(t.Field(i)) == key {
+			return i, true
+		}
+	}
+	return t.NumField(), true
+}
+
+// jsonChildType returns the type of the value at a path element below a value of type t, or
+// nil if it is not known
+func jsonChildType(t reflect.Type, element pathElement) reflect.Type {
+	if structType := jsonStructType(t); structType != nil {
+		for i := 0; i < structType.NumField(); i++ {
+			if !element.named && jsonKey(structType.Field(i)) == element.key {
+				return structType.Field(i).Type
+			}
+		}
+		return nil
+	}
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Map) {
+		return t.Elem()
+	}
+	return nil
+}
+
+// isJSONSpace reports whether a character is JSON whitespace
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// jsoncConfig is a JSONC config file with comments and trailing commas
+const jsoncConfig = `{
+  // Shared project settings
+  "name": "test",
+  "repos": [
+    // The API server
+    {"name": "api", "url": "https://example.com/api.git"},
+    {
+      "name": "web", // frontend
+      "url": "https://example.com/web.git",
+      "branch": "main",
+    },
+  ],
+  "applications": [
+    {"name": "shop", "repos": ["api", "web"], "scripts": {"build": "make"}},
+  ],
+}
+`
+
+func TestSaveConfigEditsJSONInPlace(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(config *MessConfig)
+		want string
+	}{
+		{
+			name: "nothing changed",
+			edit: func(config *MessConfig) {},
+			want: jsoncConfig,
+		},
+		{
+			name: "change a value",
+			edit: func(config *MessConfig) { config.Repos[1].Branch = "develop" },
+			want: `{
+  // Shared project settings
+  "name": "test",
+  "repos": [
+    // The API server
+    {"name": "api", "url": "https://example.com/api.git"},
+    {
+      "name": "web", // frontend
+      "url": "https://example.com/web.git",
+      "branch": "develop",
+    },
+  ],
+  "applications": [
+    {"name": "shop", "repos": ["api", "web"], "scripts": {"build": "make"}},
+  ],
+}
+`,
+		},
+		{
+			name: "add a member",
+			edit: func(config *MessConfig) { config.Repos[1].Commit = "abc123" },
+			want: `{
+  // Shared project settings
+  "name": "test",
+  "repos": [
+    // The API server
+    {"name": "api", "url": "https://example.com/api.git"},
+    {
+      "name": "web", // frontend
+      "url": "https://example.com/web.git",
+      "branch": "main",
+      "commit": "abc123",
+    },
+  ],
+  "applications": [
+    {"name": "shop", "repos": ["api", "web"], "scripts": {"build": "make"}},
+  ],
+}
+`,
+		},
+		{
+			name: "add a list item",
+			edit: func(config *MessConfig) {
+				config.Repos = append(config.Repos, RepoDefinition{Name: "docs", URL: "https://example.com/docs.git"})
+			},
+			want: `{
+  // Shared project settings
+  "name": "test",
+  "repos": [
+    // The API server
+    {"name": "api", "url": "https://example.com/api.git"},
+    {
+      "name": "web", // frontend
+      "url": "https://example.com/web.git",
+      "branch": "main",
+    },
+    {
+      "name": "docs",
+      "url": "https://example.com/docs.git"
+    },
+  ],
+  "applications": [
+    {"name": "shop", "repos": ["api", "web"], "scripts": {"build": "make"}},
+  ],
+}
+`,
+		},
+		{
+			name: "remove a list item with its comment",
+			edit: func(config *MessConfig) {
+				config.Repos = config.Repos[1:]
+				config.Applications[0].Repos = []string{"web"}
+			},
+			want: `{
+  // Shared project settings
+  "name": "test",
+  "repos": [
+    {
+      "name": "web", // frontend
+      "url": "https://example.com/web.git",
+      "branch": "main",
+    },
+  ],
+  "applications": [
+    {"name": "shop", "repos": ["web"], "scripts": {"build": "make"}},
+  ],
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := writeProject(t, map[string]string{"mess.json": jsoncConfig})
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			tt.edit(config)
+			if err := SaveConfig(config, configPath); err != nil {
+				t.Fatalf("SaveConfig() error = %v", err)
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("saved file =\n%s\nwant\n%s", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// jsonNode is a value of a parsed JSON document, with its location in the source
+type jsonNode struct {
+	// kind is '{' for objects, '[' for arrays, '"' for strings and 'v' for other values
+	kind byte
+	// start and end are the offsets of the value in the source
+	start, end int
+	// members are the members of an object, in order
+	members []*jsonMember
+	// items are the elements of an array
+	items []*jsonNode
+	// text is the decoded value of a string
+	text string
+}
+
+// jsonMember is a key and value of an object
+type jsonMember struct {
+	key string
+	// keyStart is the offset of the quoted key in the source
+	keyStart int
+	value    *jsonNode
+}
+
+// jsonSyntaxError is a parse error at an offset of the source
+type jsonSyntaxError struct {
+	msg    string
+	offset int
+}
+
+func (e *jsonSyntaxError) Error() string { return e.msg }
+
+// parseJSON parses a JSON document into a tree of nodes that keeps the location of every
+// value, which encoding/json does not. Trailing commas are accepted, and comments are removed
+// first with stripJSONC
+func parseJSON(data []byte) (*jsonNode, error) {
+	p := &jsonParser{data: data}
+	p.skipSpace()
+	node, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.data) {
+		return nil, p.errorf("unexpected %s after the top-level value", p.describe())
+	}
+	return node, nil
+}
+
+// member returns the value of a key of an object node, or nil
+func (n *jsonNode) member(key string) *jsonNode {
+	for _, member := range n.members {
+		if member.key == key {
+			return member.value
+		}
+	}
+	return nil
+}
+
+type jsonParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *jsonParser) errorf(format string, args ...interface{}) error {
+	return &jsonSyntaxError{msg: fmt.Sprintf(format, args...), offset: p.pos}
+}
+
+// describe names the character at the current position, for errors
+func (p *jsonParser) describe() string {
+	if p.pos >= len(p.data) {
+		return "end of file"
+	}
+	r, _ := utf8.DecodeRune(p.data[p.pos:])
+	return fmt.Sprintf("character %q", r)
+}
+
+// skipSpace skips whitespace between tokens
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// value parses the value at the current position
+func (p *jsonParser) value() (*jsonNode, error) {
+	if p.pos >= len(p.data) {
+		return nil, p.errorf("unexpected end of file, expected a value")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"':
+		start := p.pos
+		text, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		return &jsonNode{kind: '"', start: start, end: p.pos, text: text}, nil
+	default:
+		return p.literal()
+	}
+}
+
+// object parses an object
+func (p *jsonParser) object() (*jsonNode, error) {
+	node := &jsonNode{kind: '{', start: p.pos}
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		node.end = p.pos
+		return node, nil
+	}
+
+	for {
+		if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+			return nil, p.errorf("unexpected %s, expected an object key", p.describe())
+		}
+		member := &jsonMember{keyStart: p.pos}
+		key, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		member.key = key
+
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.data[p.pos] != ':' {
+			return nil, p.errorf("unexpected %s, expected ':' after object key", p.describe())
+		}
+		p.pos++
+		p.skipSpace()
+		if member.value, err = p.value(); err != nil {
+			return nil, err
+		}
+		node.members = append(node.members, member)
+
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+			p.skipSpace()
+			if p.pos >= len(p.data) || p.data[p.pos] != '}' {
+				continue
+			}
+		}
+		if p.pos < len(p.data) && p.data[p.pos] == '}' {
+			p.pos++
+			node.end = p.pos
+			return node, nil
+		}
+		return nil, p.errorf("unexpected %s, expected ',' or '}' after object value", p.describe())
+	}
+}
+
+// array parses an array
+func (p *jsonParser) array() (*jsonNode, error) {
+	node := &jsonNode{kind: '[', start: p.pos}
+	p.pos++
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		node.end = p.pos
+		return node, nil
+	}
+
+	for {
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == ',' {
+			p.pos++
+			p.skipSpace()
+			if p.pos >= len(p.data) || p.data[p.pos] != ']' {
+				continue
+			}
+		}
+		if p.pos < len(p.data) && p.data[p.pos] == ']' {
+			p.pos++
+			node.end = p.pos
+			return node, nil
+		}
+		return nil, p.errorf("unexpected %s, expected ',' or ']' after array element", p.describe())
+	}
+}
+
+// string parses a quoted string and returns its decoded value
+func (p *jsonParser) string() (string, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos += 2
+		case '"':
+			p.pos++
+			var text string
+			if err := json.Unmarshal(p.data[start:p.pos], &text); err != nil {
+				p.pos = start
+				return "", p.errorf("invalid string: %v", err)
+			}
+			return text, nil
+		case '\n':
+			return "", p.errorf("unexpected end of line in string")
+		default:
+			p.pos++
+		}
+	}
+	return "", p.errorf("unexpected end of file in string")
+}
+
+// literal parses a number, true, false or null
+func (p *jsonParser) literal() (*jsonNode, error) {
+	start := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == ',' || c == '}' || c == ']' || c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			break
+		}
+		p.pos++
+	}
+	if start == p.pos || !json.Valid(p.data[start:p.pos]) {
+		p.pos = start
+		return nil, p.errorf("unexpected %s, expected a value", p.describe())
+	}
+	return &jsonNode{kind: 'v', start: start, end: p.pos}, nil
+}
+
+// stripJSONC blanks the comments and trailing commas of JSONC, the JSON with comments used by
+// editors, so it can be decoded as JSON. Offsets are unchanged, so errors and the positions of
+// parsed nodes also apply to the original text
+func stripJSONC(data []byte) []byte {
+	return blankJSONC(data, true)
+}
+
+// blankJSONC replaces the comments of JSONC with spaces and, if commas is set, its trailing commas
+func blankJSONC(data []byte, commas bool) []byte {
+	out := append([]byte{}, data...)
+	comma := -1
+	for i := 0; i < len(out); i++ {
+		switch c := out[i]; {
+		case c == '"':
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+			comma = -1
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				// Left for the decoder to report
+				return out
+			}
+			for end += i + 4; i < end; i++ {
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+			i--
+		case c == ',':
+			comma = i
+		case c == '}' || c == ']':
+			if comma >= 0 && commas {
+				out[comma] = ' '
+			}
+			comma = -1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			comma = -1
+		}
+	}
+	return out
+}
+
+// lineColumn converts an offset of data into a line and a column, both starting at 1.
+// Columns count characters, not bytes
+func lineColumn(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line, lineStart := 1, 0
+	for i := 0; i < offset; i++ {
+		if data[i] == '\n' {
+			line++
+			lineStart = i + 1
+		}
+	}
+	return line, utf8.RuneCount(data[lineStart:offset]) + 1
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LockFile represents the mess.lock file recording the exact commit of every cloned repository
+type LockFile struct {
+	Repos []LockedRepo `json:"repos"`
+}
+
+// LockedRepo represents the resolved revision of a single repository
+type LockedRepo struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Commit string `json:"commit"`
+}
+
+// LockPath returns the path of the lock file that belongs to the given config file
+// (mess.json -> mess.lock)
+func LockPath(configPath string) string {
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+	ext := filepath.Ext(configPath)
+	return strings.TrimSuffix(configPath, ext) + ".lock"
+}
+
+// LoadLock loads the lock file that belongs to the given config file
+func LoadLock(configPath string) (*LockFile, error) {
+	lockPath := LockPath(configPath)
+
+	data, err := os.ReadFile(lockPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("lock file not found: %s. Run 'mess lock' first", lockPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %v", err)
+	}
+
+	var lock LockFile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lock file: %v", err)
+	}
+
+	return &lock, nil
+}
+
+// SaveLock writes the lock file next to the given config file
+func SaveLock(lock *LockFile, configPath string) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock file: %v", err)
+	}
+
+	if err := os.WriteFile(LockPath(configPath), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lock file: %v", err)
+	}
+
+	return nil
+}
+
+// Find returns the locked revision of a repository, or nil if it is not locked
+func (l *LockFile) Find(repoName string) *LockedRepo {
+	for i := range l.Repos {
+		if l.Repos[i].Name == repoName {
+			return &l.Repos[i]
+		}
+	}
+	return nil
+}
+
+// Apply pins every locked repository in the configuration to its locked commit.
+// It returns the names of repositories that have no entry in the lock file
+func (l *LockFile) Apply(config *MessConfig) ([]string, error) {
+	var unlocked []string
+	for i := range config.Repos {
+		repo := &config.Repos[i]
+		locked := l.Find(repo.Name)
+		if locked == nil {
+			unlocked = append(unlocked, repo.Name)
+			continue
+		}
+		if locked.URL != repo.URL {
+			return nil, fmt.Errorf("lock file is out of date for repo %s: locked URL %s does not match %s. Run 'mess lock' again", repo.Name, locked.URL, repo.URL)
+		}
+		repo.Ref = ""
+		repo.Branch = ""
+		repo.Commit = locked.Commit
+	}
+	return unlocked, nil
+}
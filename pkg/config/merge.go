@@ -0,0 +1,485 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// LocalConfigPath returns the path of the local override file that belongs to the given
+// config file (mess.json -> mess.local.json)
+func LocalConfigPath(configPath string) string {
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+	ext := filepath.Ext(configPath)
+	return strings.TrimSuffix(configPath, ext) + ".local" + ext
+}
+
+// configSource records the documents a configuration was loaded from, so that SaveConfig
+// can write changes back to the base file without the content of the override files
+type configSource struct {
+	// path is the path of the base config file, relative to the project root
+	path string
+	// base is the document of the base config file, and data its content
+	base map[string]interface{}
+	data []byte
+	// snapshot is the loaded configuration, encoded as a document
+	snapshot map[string]interface{}
+	// fragments are the included files, added to the base file
+	fragments []sourceFile
+	// local are the local override files that were merged onto the base file and the fragments
+	local []sourceFile
+	// files records the file each repository and application comes from
+	files provenance
+}
+
+// origin returns the file a setting that is not in the base file comes from: the fragment
+// that defines the repository or application, or else the override files
+func (s *configSource) origin(path []pathElement) string {
+	if len(path) >= 2 && path[1].named {
+		for _, frag := range s.fragments {
+			if list, ok := frag.doc[path[0].key].([]interface{}); ok && indexOfName(list, path[1].key) >= 0 {
+				return frag.path
+			}
+		}
+	}
+	return s.localPaths()
+}
+
+// localPaths returns the paths of the local override files, for messages
+func (s *configSource) localPaths() string {
+	paths := make([]string, len(s.local))
+	for i, local := range s.local {
+		paths[i] = local.path
+	}
+	return strings.Join(paths, ", ")
+}
+
+// checkSchema returns the keys of the loaded files that are not in the schema, which would be
+// ignored, and the values of the wrong type
+func (s *configSource) checkSchema() problemList {
+	var problems problemList
+	for _, file := range s.sourceFiles() {
+		for _, problem := range schemaProblems(file.doc) {
+			problem.File = file.path
+			problem.Line, problem.Column = file.position(problem.path)
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// compose returns a document with the repositories and applications of the fragments added to doc
+func (s *configSource) compose(doc map[string]interface{}) map[string]interface{} {
+	composed := make(map[string]interface{}, len(doc))
+	for key, value := range doc {
+		composed[key] = value
+	}
+	for _, frag := range s.fragments {
+		appendFragment(composed, frag)
+	}
+	return composed
+}
+
+// apply returns a copy of the base document with the changes from the snapshot to current applied
+func (s *configSource) apply(current map[string]interface{}) (map[string]interface{}, error) {
+	// Work on a copy, so a failed save leaves the source untouched
+	base, err := copyDocument(s.base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %v", err)
+	}
+
+	for _, op := range diffDocuments(s.snapshot, current, nil, nil) {
+		// A setting of an override file would still override the base file after the save
+		if local := s.overriddenBy(op.path); local != "" {
+			return nil, fmt.Errorf("cannot save changes to %s: it comes from %s, edit that file instead", describePath(op.path), local)
+		}
+		if list, ok := op.value.([]interface{}); ok {
+			baseList, _ := documentValue(base, op.path).([]interface{})
+			oldList, _ := documentValue(s.snapshot, op.path).([]interface{})
+			op.value = editList(baseList, oldList, list)
+		}
+		if err := applyPatch(base, op); err != nil {
+			if origin := s.origin(op.path); origin != "" {
+				return nil, fmt.Errorf("cannot save changes to %s: it comes from %s, edit that file instead", describePath(op.path), origin)
+			}
+			return nil, fmt.Errorf("cannot save changes to %s: %v", describePath(op.path), err)
+		}
+	}
+	return base, nil
+}
+
+// overriddenBy returns the local override files that set the value at path, or "" if none does
+func (s *configSource) overriddenBy(path []pathElement) string {
+	var paths []string
+	for _, local := range s.local {
+		if documentDepth(local.doc, path) == len(path) {
+			paths = append(paths, local.path)
+		}
+	}
+	return strings.Join(paths, ", ")
+}
+
+// documentValue returns the value at path in a document, or nil if there is none
+func documentValue(doc map[string]interface{}, path []pathElement) interface{} {
+	var value interface{} = doc
+	for _, element := range path {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			value = container[element.key]
+		case []interface{}:
+			index := indexOfName(container, element.key)
+			if index < 0 {
+				return nil
+			}
+			value = container[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// editList applies the change from the old to the new list to the base file's own list: the
+// elements that were removed are removed from it and those that were added are appended
+func editList(base, old, new []interface{}) []interface{} {
+	if base == nil || reflect.DeepEqual(base, old) {
+		return new
+	}
+	edited := append([]interface{}{}, base...)
+	for _, element := range old {
+		if indexOfValue(new, element) < 0 {
+			if index := indexOfValue(edited, element); index >= 0 {
+				edited = append(edited[:index], edited[index+1:]...)
+			}
+		}
+	}
+	for _, element := range new {
+		if indexOfValue(old, element) < 0 && indexOfValue(edited, element) < 0 {
+			edited = append(edited, element)
+		}
+	}
+	return edited
+}
+
+// indexOfValue returns the index of a value in a list, or -1
+func indexOfValue(list []interface{}, value interface{}) int {
+	for i, element := range list {
+		if reflect.DeepEqual(element, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// decodeDocument decodes a JSON object into a generic document, keeping numbers as they are
+func decodeDocument(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("config must be a JSON object")
+	}
+	return doc, nil
+}
+
+// copyDocument returns a deep copy of a document
+func copyDocument(doc map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(data)
+}
+
+// toDocument encodes a value as a generic document
+func toDocument(value interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(data)
+}
+
+// loadOverlay merges the override file at path onto doc, if the file exists. It returns the merged
+// document and the override file, or nil if there is none. A file without a version is migrated
+// from the given version
+func loadOverlay(doc map[string]interface{}, path string, configPath string, version int) (map[string]interface{}, *sourceFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return doc, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	overlay := &sourceFile{path: displayPath(path, configPath), data: data}
+	if overlay.doc, err = decodeFormat(FormatOf(path), data); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", parseProblem(overlay.path, data, err))
+	}
+	if _, err := migrateDocument(overlay.doc, version); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", overlay.path, err)
+	}
+	return mergeValues(doc, overlay.doc).(map[string]interface{}), overlay, nil
+}
+
+// mergeValues merges an override value onto a base value:
+//   - objects are merged key by key, and a null value removes the key
+//   - lists of objects with a "name" are merged by name: objects with the same name are
+//     merged, and new objects are appended
+//   - other values, including other lists, are replaced
+func mergeValues(base, overlay interface{}) interface{} {
+	switch overlayValue := overlay.(type) {
+	case map[string]interface{}:
+		baseMap, ok := base.(map[string]interface{})
+		if !ok {
+			baseMap = map[string]interface{}{}
+		}
+		merged := make(map[string]interface{}, len(baseMap)+len(overlayValue))
+		for key, value := range baseMap {
+			merged[key] = value
+		}
+		for key, value := range overlayValue {
+			if value == nil {
+				delete(merged, key)
+				continue
+			}
+			merged[key] = mergeValues(merged[key], value)
+		}
+		return merged
+
+	case []interface{}:
+		baseList, ok := base.([]interface{})
+		if !ok || !isNamedList(baseList) || !isNamedList(overlayValue) {
+			return overlayValue
+		}
+		merged := append([]interface{}{}, baseList...)
+		for _, element := range overlayValue {
+			if index := indexOfName(merged, elementName(element)); index >= 0 {
+				merged[index] = mergeValues(merged[index], element)
+			} else {
+				merged = append(merged, element)
+			}
+		}
+		return merged
+
+	default:
+		return overlay
+	}
+}
+
+// isNamedList reports whether every element of a list is an object with a string "name"
+func isNamedList(list []interface{}) bool {
+	for _, element := range list {
+		if elementName(element) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// elementName returns the "name" of an object in a list, or "" if it has none
+func elementName(element interface{}) string {
+	object, ok := element.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	name, _ := object["name"].(string)
+	return name
+}
+
+// indexOfName returns the index of the object with the given name in a list, or -1
+func indexOfName(list []interface{}, name string) int {
+	for i, element := range list {
+		if elementName(element) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// pathElement is a step into a document: an object key or, in a named list, the name of an element
+type pathElement struct {
+	key   string
+	named bool
+	// index is the position of the element in the list, which tells elements with the same name apart
+	index int
+}
+
+// patchOp sets or removes the value at a path of a document
+type patchOp struct {
+	path   []pathElement
+	value  interface{}
+	remove bool
+}
+
+// describePath formats a path for messages, e.g. applications[web].env.PORT
+func describePath(path []pathElement) string {
+	var b strings.Builder
+	for _, element := range path {
+		if element.named {
+			fmt.Fprintf(&b, "[%s]", element.key)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(element.key)
+	}
+	return b.String()
+}
+
+// diffDocuments returns the operations that turn the old document into the new one.
+// Named lists are compared by name, so changes stay attached to the same entity
+func diffDocuments(oldValue, newValue interface{}, path []pathElement, ops []patchOp) []patchOp {
+	child := func(element pathElement) []pathElement {
+		return append(append([]pathElement{}, path...), element)
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		for _, key := range sortedKeys(oldMap) {
+			if _, exists := newMap[key]; !exists {
+				ops = append(ops, patchOp{path: child(pathElement{key: key}), remove: true})
+			}
+		}
+		for _, key := range sortedKeys(newMap) {
+			if oldChild, exists := oldMap[key]; exists {
+				ops = diffDocuments(oldChild, newMap[key], child(pathElement{key: key}), ops)
+			} else {
+				ops = append(ops, patchOp{path: child(pathElement{key: key}), value: newMap[key]})
+			}
+		}
+		return ops
+	}
+
+	oldList, oldIsList := oldValue.([]interface{})
+	newList, newIsList := newValue.([]interface{})
+	if oldIsList && newIsList && len(oldList) > 0 && isNamedList(oldList) && isNamedList(newList) {
+		for _, element := range oldList {
+			if indexOfName(newList, elementName(element)) < 0 {
+				ops = append(ops, patchOp{path: child(pathElement{key: elementName(element), named: true}), remove: true})
+			}
+		}
+		for _, element := range newList {
+			name := elementName(element)
+			if index := indexOfName(oldList, name); index >= 0 {
+				ops = diffDocuments(oldList[index], element, child(pathElement{key: name, named: true}), ops)
+			} else {
+				ops = append(ops, patchOp{path: child(pathElement{key: name, named: true}), value: element})
+			}
+		}
+		return ops
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		ops = append(ops, patchOp{path: path, value: newValue})
+	}
+	return ops
+}
+
+// sortedKeys returns the keys of an object in order, so patches are applied deterministically
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// applyPatch applies an operation to a base document. It fails if the operation changes
+// something that is not in the base document, which means it came from an override file
+func applyPatch(doc map[string]interface{}, op patchOp) error {
+	notInBase := fmt.Errorf("%s is not defined in the base config file", describePath(op.path))
+
+	var parent interface{} = doc
+	for i, element := range op.path {
+		last := i == len(op.path)-1
+
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if last {
+				if op.remove {
+					if _, exists := container[element.key]; !exists {
+						return notInBase
+					}
+					delete(container, element.key)
+				} else {
+					container[element.key] = op.value
+				}
+				return nil
+			}
+			next, exists := container[element.key]
+			if !exists {
+				// Settings that were not set yet, such as the env of an application
+				if !op.path[i+1].named {
+					next = map[string]interface{}{}
+				} else {
+					next = []interface{}{}
+				}
+				container[element.key] = next
+			}
+			parent = next
+
+		case []interface{}:
+			index := indexOfName(container, element.key)
+			if last {
+				switch {
+				case op.remove && index < 0:
+					return notInBase
+				case op.remove:
+					setChild(doc, op.path[:i], append(container[:index:index], container[index+1:]...))
+				case index >= 0:
+					container[index] = op.value
+				default:
+					setChild(doc, op.path[:i], append(container, op.value))
+				}
+				return nil
+			}
+			if index < 0 {
+				return notInBase
+			}
+			parent = container[index]
+
+		default:
+			return notInBase
+		}
+	}
+
+	return fmt.Errorf("cannot replace the whole config document")
+}
+
+// setChild replaces the value at a path of a document, used when a list grows or shrinks
+func setChild(doc map[string]interface{}, path []pathElement, value interface{}) {
+	var parent interface{} = doc
+	for i, element := range path {
+		last := i == len(path)-1
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			if last {
+				container[element.key] = value
+				return
+			}
+			parent = container[element.key]
+		case []interface{}:
+			index := indexOfName(container, element.key)
+			if last {
+				container[index] = value
+				return
+			}
+			parent = container[index]
+		}
+	}
+}
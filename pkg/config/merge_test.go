@@ -0,0 +1,180 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeProject writes the given files to a new directory, creating the directories in their
+// names, and returns the path of its mess.json
+func writeProject(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "mess.json")
+}
+
+const mergeTestConfig = `{
+  "name": "test",
+  "repos": [
+    {"name": "a", "url": "https://example.com/a.git"},
+    {"name": "b", "url": "https://example.com/b.git"},
+    {"name": "c", "url": "https://example.com/c.git"}
+  ],
+  "applications": [
+    {"name": "web", "repos": ["a", "b"], "scripts": {}}
+  ]
+}
+`
+
+func TestSaveConfigKeepsLocalOverridesOut(t *testing.T) {
+	tests := []struct {
+		name    string
+		local   string
+		edit    func(config *MessConfig)
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "list without override",
+			edit: func(config *MessConfig) {
+				config.Applications[0].Repos = append(config.Applications[0].Repos, "c")
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:  "list overridden by the local file",
+			local: `{"applications": [{"name": "web", "repos": ["a"]}]}`,
+			edit: func(config *MessConfig) {
+				config.Applications[0].Repos = append(config.Applications[0].Repos, "c")
+			},
+			wantErr: "cannot save changes to applications[web].repos: it comes from mess.local.json, edit that file instead",
+		},
+		{
+			name:  "other setting of an overridden application",
+			local: `{"applications": [{"name": "web", "repos": ["a"]}]}`,
+			edit: func(config *MessConfig) {
+				config.Applications[0].PreSetup = "make deps"
+			},
+			want: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{"mess.json": mergeTestConfig}
+			if tt.local != "" {
+				files["mess.local.json"] = tt.local
+			}
+			configPath := writeProject(t, files)
+
+			config, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			tt.edit(config)
+			err = SaveConfig(config, configPath)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("SaveConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				data, _ := os.ReadFile(configPath)
+				if string(data) != mergeTestConfig {
+					t.Errorf("mess.json changed after a failed save:\n%s", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SaveConfig() error = %v", err)
+			}
+
+			os.Remove(LocalConfigPath(configPath))
+			saved, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("LoadConfig() after save error = %v", err)
+			}
+			if got := saved.Applications[0].Repos; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("repos in mess.json = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditList(t *testing.T) {
+	list := func(values ...interface{}) []interface{} { return values }
+
+	tests := []struct {
+		name           string
+		base, old, new []interface{}
+		want           []interface{}
+	}{
+		{name: "same as loaded", base: list("a", "b"), old: list("a", "b"), new: list("b", "a", "c"), want: list("b", "a", "c")},
+		{name: "not in base", old: list("a"), new: list("a", "c"), want: list("a", "c")},
+		{name: "add", base: list("a", "b"), old: list("a"), new: list("a", "c"), want: list("a", "b", "c")},
+		{name: "remove", base: list("a", "b"), old: list("a", "b", "x"), new: list("b", "x"), want: list("b")},
+		{name: "add existing", base: list("a", "b"), old: list("a"), new: list("a", "b"), want: list("a", "b")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := editList(tt.base, tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("editList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverriddenBy(t *testing.T) {
+	source := &configSource{local: []sourceFile{{
+		path: "mess.local.json",
+		doc: map[string]interface{}{
+			"applications": []interface{}{map[string]interface{}{"name": "web", "repos": []interface{}{"a"}}},
+		},
+	}}}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "applications[web].repos", want: "mess.local.json"},
+		{path: "applications[web]", want: "mess.local.json"},
+		{path: "applications[web].env", want: ""},
+		{path: "applications[api].repos", want: ""},
+		{path: "repos", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := source.overriddenBy(parseTestPath(tt.path)); got != tt.want {
+				t.Errorf("overriddenBy(%s) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// parseTestPath parses a path formatted by describePath, e.g. applications[web].repos
+func parseTestPath(s string) []pathElement {
+	var path []pathElement
+	for _, part := range strings.Split(s, ".") {
+		key, rest, named := strings.Cut(part, "[")
+		path = append(path, pathElement{key: key})
+		for named {
+			var name string
+			name, rest, _ = strings.Cut(rest, "]")
+			path = append(path, pathElement{key: name, named: true})
+			_, rest, named = strings.Cut(rest, "[")
+		}
+	}
+	return path
+}
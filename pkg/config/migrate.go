@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// migration upgrades a config document from one version to the next
+type migration struct {
+	description string
+	apply       func(doc map[string]interface{}) error
+}
+
+// migrations upgrade config documents step by step: migrations[i] upgrades a document of
+// version i to version i+1. Files written before the version key existed are version 0.
+// Migrations also run on included and local override files, which may only have some keys
+var migrations = []migration{
+	{
+		// Version 1 is the format of the files written before versioning: only the key is added
+		description: "add the version key",
+		apply:       func(doc map[string]interface{}) error { return nil },
+	},
+}
+
+// CurrentVersion is the config version written by this version of mess
+var CurrentVersion = len(migrations)
+
+// documentVersion returns the version key of a document, or fallback if it has none
+func documentVersion(doc map[string]interface{}, fallback int) (int, error) {
+	value, exists := doc["version"]
+	if !exists {
+		return fallback, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("version must be a number")
+	}
+	version, err := number.Int64()
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("version must be a positive integer, not %s", number)
+	}
+	return int(version), nil
+}
+
+// migrateDocument upgrades a document to CurrentVersion in place. Documents without a
+// version key are taken to be of version fallback. It returns the descriptions of the
+// migrations that were applied
+func migrateDocument(doc map[string]interface{}, fallback int) ([]string, error) {
+	version, err := documentVersion(doc, fallback)
+	if err != nil {
+		return nil, err
+	}
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("config version %d is newer than the versions this mess supports (up to %d), upgrade mess to use it", version, CurrentVersion)
+	}
+
+	var applied []string
+	for ; version < CurrentVersion; version++ {
+		step := migrations[version]
+		if err := step.apply(doc); err != nil {
+			return nil, fmt.Errorf("failed to migrate config from version %d to %d (%s): %v", version, version+1, step.description, err)
+		}
+		doc["version"] = json.Number(fmt.Sprint(version + 1))
+		applied = append(applied, fmt.Sprintf("version %d to %d: %s", version, version+1, step.description))
+	}
+	return applied, nil
+}
+
+// MigrateConfig upgrades a config file to CurrentVersion. It returns the current content of
+// the file, the upgraded content and the migrations that were applied, without writing anything
+func MigrateConfig(configPath string) ([]byte, []byte, []string, error) {
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	doc, err := decodeFormat(FormatOf(configPath), data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	applied, err := migrateDocument(doc, 0)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(applied) == 0 {
+		return data, data, nil, nil
+	}
+
+	// JSON files are edited in place, keeping their formatting and comments
+	if FormatOf(configPath) == FormatJSON {
+		if migrated := editedJSON(data, doc); migrated != nil {
+			return data, migrated, applied, nil
+		}
+	}
+
+	var config MessConfig
+	encoded, err := json.Marshal(doc)
+	if err == nil {
+		err = json.Unmarshal(encoded, &config)
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+	migrated, err := encodeFormat(FormatOf(configPath), &config, extensionKeys(doc))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to marshal config: %v", err)
+	}
+	return data, migrated, applied, nil
+}
@@ -0,0 +1,561 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProjectRoot returns the directory containing the config file
+func ProjectRoot(configPath string) string {
+	if configPath == "" {
+		configPath = "mess.json"
+	}
+	root, err := filepath.Abs(filepath.Dir(configPath))
+	if err != nil {
+		root, _ = os.Getwd()
+	}
+	return root
+}
+
+// ApplicationDir returns the directory an application is set up in, inside MESS_APPLICATION_ROOT
+// if it is set, otherwise in the applications directory next to the config file
+func ApplicationDir(appName, configPath string) string {
+	if appRoot := os.Getenv("MESS_APPLICATION_ROOT"); appRoot != "" {
+		return filepath.Join(appRoot, appName)
+	}
+	return filepath.Join(ProjectRoot(configPath), "applications", appName)
+}
+
+// RepositoryDir returns the directory a repository is cloned into
+func RepositoryDir(repoName, configPath string) string {
+	return filepath.Join(ProjectRoot(configPath), "repos", repoName)
+}
+
+// Resolve returns a copy of the configuration with variable references expanded in repository
+// URLs, clone parameters and env, and in the project env and application environments, scripts,
+// setup commands and services.
+//
+// Supported references are ${env:VAR} (or ${env:VAR:-default}), ${repo:NAME.path},
+// ${repo:NAME.url}, ${repo:NAME.name}, ${app.dir}, ${app.name}, ${project.name},
+// ${project.root} and ${KEY} for a variable of the environment the string belongs to.
+// Other ${NAME} references are left alone so the shell can expand them, and $${ is a
+// literal ${. Repository URLs and clone parameters never reach a shell, so other references
+// are errors there. A variable that refers to itself gets the value of the layer below, or
+// of the environment of mess.
+//
+// The environments are layered, later layers overriding earlier ones:
+//   - the project env: the MESS_PROJECT, MESS_ROOT and MESS_REPO_<NAME>_PATH variables,
+//     the variables of the project env_files and the project env
+//   - the application env: the project env, the MESS_APP and MESS_APP_DIR variables, the
+//     variables of the application env_files and the application env
+//   - the env of scripts and services: the env of the repository they run in, if their cwd
+//     is a repository, and their own env
+//
+// Values from env files are used as they are, without expansion
+func Resolve(config *MessConfig, configPath string) (*MessConfig, error) {
+	resolved := *config
+	r := &resolver{config: config, configPath: configPath, root: ProjectRoot(configPath)}
+
+	// The project environment is available to everything else
+	projectFileEnv, err := LoadEnvFiles(config.EnvFiles, configPath)
+	if err != nil {
+		return nil, err
+	}
+	r.project = &scope{inline: config.Env, lower: mergeMaps(r.projectVariables(), projectFileEnv)}
+	r.scope = r.project
+	if resolved.Env, err = r.resolveScope(r.project); err != nil {
+		return nil, fmt.Errorf("env %v", err)
+	}
+
+	resolved.Repos = make([]RepoDefinition, len(config.Repos))
+	repoEnvs := make(map[string]map[string]string, len(config.Repos))
+	for i, repo := range config.Repos {
+		url, err := r.repoURL(&repo)
+		if err != nil {
+			return nil, fmt.Errorf("repository %s: url: %v", repo.Name, err)
+		}
+		repo.URL = url
+		if repo.CloneParams != nil {
+			params := make([]string, len(repo.CloneParams))
+			r.strict = true
+			for j, param := range repo.CloneParams {
+				if params[j], err = r.expand(param); err != nil {
+					r.strict = false
+					return nil, fmt.Errorf("repository %s: clone_params: %v", repo.Name, err)
+				}
+			}
+			r.strict = false
+			repo.CloneParams = params
+		}
+		if repo.Env != nil {
+			r.scope = &scope{inline: repo.Env, lower: resolved.Env}
+			env, err := r.resolveScope(r.scope)
+			r.scope = r.project
+			if err != nil {
+				return nil, fmt.Errorf("repository %s: env %v", repo.Name, err)
+			}
+			// Only the repository's own variables, the lower layers are in every environment already
+			repo.Env = make(map[string]string, len(repo.Env))
+			for key := range config.Repos[i].Env {
+				repo.Env[key] = env[key]
+			}
+			repoEnvs[repo.Name] = repo.Env
+		}
+		resolved.Repos[i] = repo
+	}
+	r.repoEnvs = repoEnvs
+
+	resolved.Applications = make([]ApplicationDefinition, len(config.Applications))
+	for i := range config.Applications {
+		app, err := r.resolveApplication(&config.Applications[i], resolved.Env)
+		if err != nil {
+			return nil, fmt.Errorf("application %s: %v", config.Applications[i].Name, err)
+		}
+		resolved.Applications[i] = *app
+	}
+
+	return &resolved, nil
+}
+
+// EnvVarName returns the name of a repository in the form used in MESS_REPO_<NAME>_PATH:
+// upper case, with characters other than letters and digits replaced by underscores
+func EnvVarName(name string) string {
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z':
+			return c - 'a' + 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+			return c
+		}
+		return '_'
+	}, name)
+}
+
+// projectVariables returns the variables mess sets for every command of the project
+func (r *resolver) projectVariables() map[string]string {
+	variables := map[string]string{
+		"MESS_PROJECT": r.config.Name,
+		"MESS_ROOT":    r.root,
+	}
+	for _, repo := range r.config.Repos {
+		variables["MESS_REPO_"+EnvVarName(repo.Name)+"_PATH"] = RepositoryDir(repo.Name, r.configPath)
+	}
+	return variables
+}
+
+// resolver expands variable references for Resolve
+type resolver struct {
+	config     *MessConfig
+	configPath string
+	root       string
+
+	// app is the application whose settings are being resolved, nil for project settings
+	app *ApplicationDefinition
+	// project is the scope of the project environment
+	project *scope
+	// scope is the environment that bare ${KEY} references refer to
+	scope *scope
+	// repoEnvs holds the resolved env of every repository that has one
+	repoEnvs map[string]map[string]string
+	// stack holds the variables being resolved, to detect cycles
+	stack []stackEntry
+	// strict is set while resolving settings that are not run by a shell, where references
+	// that are not ours are errors instead of being left to the shell
+	strict bool
+}
+
+// scope is one layer of environment variables
+type scope struct {
+	// inline holds the variables defined in the config file, which are expanded on use
+	inline map[string]string
+	// lower holds the variables of the layers below, which are used as they are
+	lower map[string]string
+	// resolved caches the expanded inline variables
+	resolved map[string]string
+}
+
+// stackEntry is a variable being resolved
+type stackEntry struct {
+	scope *scope
+	name  string
+}
+
+// resolveScope returns the environment of a scope: its lower layers and its expanded variables
+func (r *resolver) resolveScope(s *scope) (map[string]string, error) {
+	keys := make([]string, 0, len(s.inline))
+	for key := range s.inline {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	env := mergeMaps(s.lower, nil)
+	for _, key := range keys {
+		value, err := r.envValue(s, key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// resolveApplication returns a copy of an application with its settings resolved
+func (r *resolver) resolveApplication(app *ApplicationDefinition, projectEnv map[string]string) (*ApplicationDefinition, error) {
+	fileEnv, err := LoadEnvFiles(app.EnvFiles, r.configPath)
+	if err != nil {
+		return nil, err
+	}
+	variables := map[string]string{
+		"MESS_APP":     app.Name,
+		"MESS_APP_DIR": ApplicationDir(app.Name, r.configPath),
+	}
+
+	r.app = app
+	r.scope = &scope{inline: app.Env, lower: mergeMaps(mergeMaps(projectEnv, variables), fileEnv)}
+	defer func() { r.app, r.scope = nil, r.project }()
+
+	resolved := *app
+
+	// The environment first, since the other settings may refer to it
+	if resolved.Env, err = r.resolveScope(r.scope); err != nil {
+		return nil, fmt.Errorf("env %v", err)
+	}
+
+	if resolved.PreSetup, err = r.expand(app.PreSetup); err != nil {
+		return nil, fmt.Errorf("pre-setup: %v", err)
+	}
+	if resolved.PostSetup, err = r.expand(app.PostSetup); err != nil {
+		return nil, fmt.Errorf("post-setup: %v", err)
+	}
+
+	if app.Scripts != nil {
+		resolved.Scripts = make(map[string]ScriptValue, len(app.Scripts))
+	}
+	for name, script := range app.Scripts {
+		if script, err = r.resolveScript(script); err != nil {
+			return nil, fmt.Errorf("script %s: %v", name, err)
+		}
+		resolved.Scripts[name] = script
+	}
+
+	if app.Services != nil {
+		resolved.Services = make(map[string]ServiceDefinition, len(app.Services))
+	}
+	for name, service := range app.Services {
+		if service, err = r.resolveService(service); err != nil {
+			return nil, fmt.Errorf("service %s: %v", name, err)
+		}
+		resolved.Services[name] = service
+	}
+
+	return &resolved, nil
+}
+
+// resolveScript returns a script with its commands, cwd, env and readiness probe resolved
+func (r *resolver) resolveScript(script ScriptValue) (ScriptValue, error) {
+	var err error
+	if script.Single, err = r.expand(script.Single); err != nil {
+		return script, err
+	}
+	if script.Multiple != nil {
+		commands := make([]string, len(script.Multiple))
+		for i, command := range script.Multiple {
+			if commands[i], err = r.expand(command); err != nil {
+				return script, err
+			}
+		}
+		script.Multiple = commands
+	}
+	if script.Cwd, err = r.expand(script.Cwd); err != nil {
+		return script, fmt.Errorf("cwd: %v", err)
+	}
+	if script.Env, err = r.expandMap(script.Env); err != nil {
+		return script, err
+	}
+	script.Env = r.withRepoEnv(script.Cwd, script.Env)
+	if script.Ready, err = r.resolveProbe(script.Ready); err != nil {
+		return script, err
+	}
+	return script, nil
+}
+
+// resolveService returns a service with its command, cwd, env and readiness probe resolved
+func (r *resolver) resolveService(service ServiceDefinition) (ServiceDefinition, error) {
+	var err error
+	if service.Cmd, err = r.expand(service.Cmd); err != nil {
+		return service, err
+	}
+	if service.Cwd, err = r.expand(service.Cwd); err != nil {
+		return service, fmt.Errorf("cwd: %v", err)
+	}
+	if service.Env, err = r.expandMap(service.Env); err != nil {
+		return service, err
+	}
+	service.Env = r.withRepoEnv(service.Cwd, service.Env)
+	if service.Ready, err = r.resolveProbe(service.Ready); err != nil {
+		return service, err
+	}
+	return service, nil
+}
+
+// withRepoEnv adds the env of the repository a script or service runs in below its own env.
+// cwd refers to a repository if its first element is the name of a repository of the application
+func (r *resolver) withRepoEnv(cwd string, env map[string]string) map[string]string {
+	if cwd == "" || filepath.IsAbs(cwd) {
+		return env
+	}
+	repoName := strings.Split(filepath.ToSlash(filepath.Clean(cwd)), "/")[0]
+	for _, linked := range r.app.Repos {
+		if linked == repoName && r.repoEnvs[repoName] != nil {
+			return mergeMaps(r.repoEnvs[repoName], env)
+		}
+	}
+	return env
+}
+
+// resolveProbe returns a copy of a readiness probe with its checks resolved
+func (r *resolver) resolveProbe(probe *ReadinessProbe) (*ReadinessProbe, error) {
+	if probe == nil {
+		return nil, nil
+	}
+	resolved := *probe
+	var err error
+	for _, field := range []*string{&resolved.TCP, &resolved.HTTP, &resolved.Cmd} {
+		if *field, err = r.expand(*field); err != nil {
+			return nil, fmt.Errorf("ready: %v", err)
+		}
+	}
+	return &resolved, nil
+}
+
+// expandMap returns a copy of a map with its values expanded
+func (r *resolver) expandMap(values map[string]string) (map[string]string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	expanded := make(map[string]string, len(values))
+	for key, value := range values {
+		var err error
+		if expanded[key], err = r.expand(value); err != nil {
+			return nil, fmt.Errorf("env %s: %v", key, err)
+		}
+	}
+	return expanded, nil
+}
+
+// expand replaces the variable references in s
+func (r *resolver) expand(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	var result strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			result.WriteString(s)
+			return result.String(), nil
+		}
+
+		// $${ is an escaped ${
+		if start > 0 && s[start-1] == '$' {
+			result.WriteString(s[:start-1])
+			result.WriteString("${")
+			s = s[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference: %s", s[start:])
+		}
+		name := s[start+2 : start+end]
+
+		value, found, err := r.lookup(name)
+		if err != nil {
+			return "", err
+		}
+		if !found && r.strict {
+			return "", fmt.Errorf("undefined variable ${%s} (define it in env, or use ${env:%s} for a variable of the environment)", name, name)
+		}
+		result.WriteString(s[:start])
+		if found {
+			result.WriteString(value)
+		} else {
+			// Not one of ours, leave it to the shell
+			result.WriteString(s[start : start+end+1])
+		}
+		s = s[start+end+1:]
+	}
+}
+
+// lookup returns the value of a variable. found is false for names that are left to the shell
+func (r *resolver) lookup(name string) (value string, found bool, err error) {
+	switch {
+	case strings.HasPrefix(name, "env:"):
+		name, fallback, hasFallback := strings.Cut(strings.TrimPrefix(name, "env:"), ":-")
+		if value, ok := os.LookupEnv(name); ok {
+			return value, true, nil
+		}
+		if hasFallback {
+			return fallback, true, nil
+		}
+		return "", false, fmt.Errorf("environment variable %s is not set (use ${env:%s:-default} for a default value)", name, name)
+
+	case strings.HasPrefix(name, "repo:"):
+		value, err := r.repoField(strings.TrimPrefix(name, "repo:"))
+		return value, err == nil, err
+
+	case strings.HasPrefix(name, "app."):
+		if r.app == nil {
+			return "", false, fmt.Errorf("${%s} can only be used in application settings", name)
+		}
+		switch name {
+		case "app.dir":
+			return ApplicationDir(r.app.Name, r.configPath), true, nil
+		case "app.name":
+			return r.app.Name, true, nil
+		}
+		return "", false, fmt.Errorf("unknown variable ${%s} (available: app.dir, app.name)", name)
+
+	case strings.HasPrefix(name, "project."):
+		switch name {
+		case "project.name":
+			return r.config.Name, true, nil
+		case "project.root":
+			return r.root, true, nil
+		}
+		return "", false, fmt.Errorf("unknown variable ${%s} (available: project.name, project.root)", name)
+	}
+
+	// Variables of the current environment. A variable referring to itself, as in
+	// "PATH": "${PATH}:/opt/bin", refers to the layer below, or to the environment of mess
+	selfReference := len(r.stack) > 0 && r.stack[len(r.stack)-1] == stackEntry{r.scope, name}
+	if _, exists := r.scope.inline[name]; exists && !selfReference {
+		value, err := r.envValue(r.scope, name)
+		var cycleErr *referenceCycleError
+		if errors.As(err, &cycleErr) {
+			return "", false, err
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("${%s}: %v", name, err)
+		}
+		return value, true, nil
+	}
+	if value, exists := r.scope.lower[name]; exists {
+		return value, true, nil
+	}
+	if selfReference {
+		if value, exists := os.LookupEnv(name); exists {
+			return value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// mergeMaps returns a new map with the entries of base and override, override taking precedence
+func mergeMaps(base, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// envValue returns the expanded value of a variable defined in a scope
+func (r *resolver) envValue(s *scope, key string) (string, error) {
+	if value, done := s.resolved[key]; done {
+		return value, nil
+	}
+
+	scope := r.scope
+	r.scope = s
+	defer func() { r.scope = scope }()
+
+	value, err := r.guard(stackEntry{s, key}, func() (string, error) { return r.expand(s.inline[key]) })
+	if err != nil {
+		return "", err
+	}
+	if s.resolved == nil {
+		s.resolved = make(map[string]string)
+	}
+	s.resolved[key] = value
+	return value, nil
+}
+
+// repoField returns a field of a repository given as NAME.path, NAME.url or NAME.name
+func (r *resolver) repoField(ref string) (string, error) {
+	repoName, field, ok := strings.Cut(ref, ".")
+	if !ok {
+		return "", fmt.Errorf("invalid repository reference ${repo:%s} (expected ${repo:NAME.path}, .url or .name)", ref)
+	}
+
+	var repo *RepoDefinition
+	for i := range r.config.Repos {
+		if r.config.Repos[i].Name == repoName {
+			repo = &r.config.Repos[i]
+			break
+		}
+	}
+	if repo == nil {
+		return "", fmt.Errorf("${repo:%s} refers to non-existent repository: %s", ref, repoName)
+	}
+
+	switch field {
+	case "path":
+		return RepositoryDir(repo.Name, r.configPath), nil
+	case "url":
+		return r.repoURL(repo)
+	case "name":
+		return repo.Name, nil
+	}
+	return "", fmt.Errorf("unknown repository field ${repo:%s} (available: path, url, name)", ref)
+}
+
+// repoURL returns the resolved URL of a repository. URLs can refer to the project environment,
+// but not to application variables
+func (r *resolver) repoURL(repo *RepoDefinition) (string, error) {
+	app, scope := r.app, r.scope
+	r.app, r.scope = nil, r.project
+	defer func() { r.app, r.scope = app, scope }()
+
+	// URLs are not variables, so they get a scope of their own
+	entry := stackEntry{nil, "repo:" + repo.Name + ".url"}
+	strict := r.strict
+	r.strict = true
+	defer func() { r.strict = strict }()
+	return r.guard(entry, func() (string, error) { return r.expand(repo.URL) })
+}
+
+// referenceCycleError reports variables that refer to each other
+type referenceCycleError struct {
+	cycle []string
+}
+
+func (e *referenceCycleError) Error() string {
+	return "variable reference cycle: " + strings.Join(e.cycle, " -> ")
+}
+
+// guard runs resolve for a variable, failing if the variable is already being resolved
+func (r *resolver) guard(variable stackEntry, resolve func() (string, error)) (string, error) {
+	for i, entry := range r.stack {
+		if entry == variable {
+			var cycle []string
+			for _, entry := range append(r.stack[i:], variable) {
+				cycle = append(cycle, "${"+entry.name+"}")
+			}
+			return "", &referenceCycleError{cycle: cycle}
+		}
+	}
+
+	r.stack = append(r.stack, variable)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+	return resolve()
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveVariableReferences(t *testing.T) {
+	t.Setenv("MESS_TEST_HOST", "git.example.com")
+	configPath := filepath.Join(t.TempDir(), "mess.json")
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		url     string
+		want    string
+		wantErr string
+	}{
+		{name: "project variable", env: map[string]string{"HOST": "example.com"}, url: "https://${HOST}/api.git", want: "https://example.com/api.git"},
+		{name: "environment variable", url: "https://${env:MESS_TEST_HOST}/api.git", want: "https://git.example.com/api.git"},
+		{name: "environment variable with a default", url: "https://${env:MESS_TEST_UNSET:-localhost}/api.git", want: "https://localhost/api.git"},
+		{name: "escaped reference", url: "https://$${HOST}/api.git", want: "https://${HOST}/api.git"},
+		{name: "undefined variable", url: "https://${HOST}/api.git", wantErr: "repository api: url: undefined variable ${HOST}"},
+		{name: "shell default", url: "https://${HOST:-localhost}/api.git", wantErr: "repository api: url: undefined variable ${HOST:-localhost}"},
+		{name: "unset environment variable", url: "https://${env:MESS_TEST_UNSET}/api.git", wantErr: "repository api: url: "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &MessConfig{Name: "test", Env: tt.env, Repos: []RepoDefinition{{Name: "api", URL: tt.url}}}
+			resolved, err := Resolve(config, configPath)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got := resolved.Repos[0].URL; got != tt.want {
+				t.Errorf("url = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveLeavesShellReferencesInScripts(t *testing.T) {
+	config := &MessConfig{
+		Name: "test",
+		Env:  map[string]string{"OUT_DIR": "dist"},
+		Repos: []RepoDefinition{
+			{Name: "api", URL: "https://example.com/api.git", CloneParams: []string{"--depth=1"}},
+		},
+		Applications: []ApplicationDefinition{{
+			Name: "web",
+			Scripts: map[string]ScriptValue{
+				"home":  {Single: "echo ${HOME}"},
+				"port":  {Single: "echo port=${PORT:-3000}"},
+				"build": {Single: "make OUT=${OUT_DIR} ARGS=${1}"},
+			},
+		}},
+	}
+	resolved, err := Resolve(config, filepath.Join(t.TempDir(), "mess.json"))
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	want := map[string]string{
+		"home":  "echo ${HOME}",
+		"port":  "echo port=${PORT:-3000}",
+		"build": "make OUT=dist ARGS=${1}",
+	}
+	for name, command := range want {
+		if got := resolved.Applications[0].Scripts[name].Single; got != command {
+			t.Errorf("script %s = %q, want %q", name, got, command)
+		}
+	}
+}
+
+func TestResolveUndefinedVariableInCloneParams(t *testing.T) {
+	config := &MessConfig{
+		Name:  "test",
+		Repos: []RepoDefinition{{Name: "api", URL: "https://example.com/api.git", CloneParams: []string{"--depth=${DEPTH}"}}},
+	}
+	_, err := Resolve(config, filepath.Join(t.TempDir(), "mess.json"))
+	if err == nil || !strings.Contains(err.Error(), "repository api: clone_params: undefined variable ${DEPTH}") {
+		t.Fatalf("Resolve() error = %v, want an error naming clone_params and ${DEPTH}", err)
+	}
+}
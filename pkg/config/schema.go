@@ -0,0 +1,322 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// schemaRequired lists the keys that must be set, by type
+var schemaRequired = map[reflect.Type][]string{
+	reflect.TypeOf(MessConfig{}):            {"name"},
+	reflect.TypeOf(RepoDefinition{}):        {"name", "url"},
+	reflect.TypeOf(ApplicationDefinition{}): {"name"},
+	reflect.TypeOf(ServiceDefinition{}):     {"cmd"},
+}
+
+// schemaEnums lists the allowed values of keys, by type and key
+var schemaEnums = map[reflect.Type]map[string][]string{
+	reflect.TypeOf(MessConfig{}):        {"git_backend": {"exec", "go-git"}},
+	reflect.TypeOf(ServiceDefinition{}): {"restart": {RestartNo, RestartOnFailure, RestartAlways}},
+}
+
+// extensionPrefix marks top-level keys that mess ignores, e.g. for YAML anchors
+const extensionPrefix = "x-"
+
+// Schema returns a JSON Schema (draft-07) describing the config file, generated from the
+// configuration types
+func Schema() map[string]interface{} {
+	definitions := map[string]interface{}{}
+	schema := schemaFor(reflect.TypeOf(MessConfig{}), definitions)
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "mess.json"
+	schema["patternProperties"] = map[string]interface{}{"^" + extensionPrefix: map[string]interface{}{}}
+	schema["definitions"] = definitions
+	return schema
+}
+
+// schemaFor returns the schema of a type. Struct types other than MessConfig are added to
+// definitions and referenced
+func schemaFor(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	switch t {
+	case reflect.TypeOf(ScriptValue{}):
+		if _, exists := definitions["ScriptValue"]; !exists {
+			definitions["ScriptValue"] = nil
+			object := structSchema(reflect.TypeOf(scriptObject{}), definitions)
+			definitions["ScriptValue"] = map[string]interface{}{
+				"oneOf": append(commandSchema()["oneOf"].([]interface{}), object),
+			}
+		}
+		return map[string]interface{}{"$ref": "#/definitions/ScriptValue"}
+	case reflect.TypeOf(json.RawMessage{}):
+		// The cmd of a script object
+		return commandSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), definitions)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), definitions)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), definitions)}
+	case reflect.Struct:
+		if t == reflect.TypeOf(MessConfig{}) {
+			return structSchema(t, definitions)
+		}
+		if _, exists := definitions[t.Name()]; !exists {
+			// Reserve the name first, for types that refer to themselves
+			definitions[t.Name()] = nil
+			definitions[t.Name()] = structSchema(t, definitions)
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the schema of a struct from its JSON keys
+func structSchema(t reflect.Type, definitions map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := jsonKey(field)
+		if key == "" {
+			continue
+		}
+		property := schemaFor(field.Type, definitions)
+		if kind := field.Type.Kind(); (kind == reflect.Slice || kind == reflect.Map) && !strings.Contains(field.Tag.Get("json"), ",omitempty") {
+			// Empty lists and maps are written as null
+			property["type"] = []string{property["type"].(string), "null"}
+		}
+		if enum, exists := schemaEnums[t][key]; exists {
+			property["enum"] = enum
+		}
+		properties[key] = property
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if required, exists := schemaRequired[t]; exists {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// commandSchema is the schema of a command: a string or an array of strings
+func commandSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+}
+
+// jsonKey returns the JSON key of a struct field, or "" if it is not encoded
+func jsonKey(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if key == "-" || field.Tag.Get("json") == "" {
+		return ""
+	}
+	return key
+}
+
+// schemaProblems returns the keys of a document that are not in the schema, e.g.
+// "unknown key repos[backend].clone_param (did you mean clone_params?)", and the values
+// of the wrong type. null values are accepted everywhere, as they remove settings in
+// local override files
+func schemaProblems(doc map[string]interface{}) problemList {
+	schema := Schema()
+	definitions := schema["definitions"].(map[string]interface{})
+
+	var problems problemList
+	var walk func(value interface{}, schema map[string]interface{}, path []pathElement)
+	walk = func(value interface{}, schema map[string]interface{}, path []pathElement) {
+		if value == nil {
+			return
+		}
+		if ref, ok := schema["$ref"].(string); ok {
+			schema = definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+		}
+		if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+			var kinds []string
+			var matched map[string]interface{}
+			for _, option := range oneOf {
+				option := option.(map[string]interface{})
+				if matched == nil && schemaTypeMatches(value, option) {
+					matched = option
+				}
+				kinds = append(kinds, describeSchemaType(option))
+			}
+			if matched == nil {
+				problems.add(path, "%s must be %s", describePath(path), joinOr(kinds))
+				return
+			}
+			schema = matched
+		} else if !schemaTypeMatches(value, schema) {
+			problems.add(path, "%s must be %s", describePath(path), describeSchemaType(schema))
+			return
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			properties, _ := schema["properties"].(map[string]interface{})
+			additional, _ := schema["additionalProperties"].(map[string]interface{})
+			for _, key := range sortedKeys(v) {
+				child := append(append([]pathElement{}, path...), pathElement{key: key})
+				switch property, known := properties[key].(map[string]interface{}); {
+				case known:
+					walk(v[key], property, child)
+				case additional != nil:
+					walk(v[key], additional, child)
+				case len(path) == 0 && strings.HasPrefix(key, extensionPrefix):
+				default:
+					problems.add(child, "unknown key %s%s", describePath(child), suggestKey(key, properties))
+				}
+			}
+		case []interface{}:
+			items, _ := schema["items"].(map[string]interface{})
+			if items == nil {
+				return
+			}
+			for i, element := range v {
+				walk(element, items, append(append([]pathElement{}, path...), itemElement(elementName(element), i)))
+			}
+		}
+	}
+	walk(doc, schema, nil)
+	return problems
+}
+
+// schemaTypeMatches reports whether a document value has the type of a schema. Schemas
+// without a type match any value
+func schemaTypeMatches(value interface{}, schema map[string]interface{}) bool {
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = []string{t}
+	case []string:
+		types = t
+	default:
+		return true
+	}
+
+	for _, t := range types {
+		switch v := value.(type) {
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case json.Number:
+			if _, err := v.Int64(); t == "integer" && err == nil {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describeSchemaType describes the type of a schema for messages, e.g. "an array of strings"
+func describeSchemaType(schema map[string]interface{}) string {
+	t, _ := schema["type"].(string)
+	if types, ok := schema["type"].([]string); ok && len(types) > 0 {
+		t = types[0]
+	}
+	switch t {
+	case "array":
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			if itemType, ok := items["type"].(string); ok {
+				return "an array of " + itemType + "s"
+			}
+		}
+		return "an array"
+	case "object":
+		return "an object"
+	case "integer":
+		return "an integer"
+	case "":
+		return "a value"
+	default:
+		return "a " + t
+	}
+}
+
+// joinOr joins alternatives for messages, e.g. "a string, an array or an object"
+func joinOr(alternatives []string) string {
+	if len(alternatives) < 2 {
+		return strings.Join(alternatives, "")
+	}
+	return strings.Join(alternatives[:len(alternatives)-1], ", ") + " or " + alternatives[len(alternatives)-1]
+}
+
+// suggestKey returns " (did you mean KEY?)" for the known key closest to a misspelled key
+func suggestKey(key string, properties map[string]interface{}) string {
+	candidates := make([]string, 0, len(properties))
+	for candidate := range properties {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		if distance := editDistance(key, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %s?)", best)
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{
+			name: "valid",
+			doc:  `{"name": "test", "repos": [{"name": "a", "url": "u", "clone_params": ["--depth=1"]}], "applications": []}`,
+		},
+		{
+			name: "unknown key with a suggestion",
+			doc:  `{"name": "test", "repos": [{"name": "a", "url": "u", "clone_param": ["--depth=1"]}], "applications": []}`,
+			want: []string{"unknown key repos[a].clone_param (did you mean clone_params?)"},
+		},
+		{
+			name: "unknown top-level key with a suggestion",
+			doc:  `{"name": "test", "repo": [], "applications": []}`,
+			want: []string{"unknown key repo (did you mean repos?)"},
+		},
+		{
+			name: "unknown key without a suggestion",
+			doc:  `{"name": "test", "repos": [], "applications": [{"name": "web", "repos": [], "scripts": {}, "database": "pg"}]}`,
+			want: []string{"unknown key applications[web].database"},
+		},
+		{
+			name: "extension keys",
+			doc:  `{"name": "test", "x-team": {"owner": "platform"}, "repos": [], "applications": []}`,
+		},
+		{
+			name: "wrong type",
+			doc:  `{"name": "test", "repos": [{"name": "a", "url": "u", "clone_params": "--depth=1"}], "applications": []}`,
+			want: []string{"repos[a].clone_params must be an array of strings"},
+		},
+		{
+			name: "null removes a setting",
+			doc:  `{"name": "test", "env": {"PORT": null}, "repos": [], "applications": []}`,
+		},
+		{
+			name: "item without a name",
+			doc:  `{"name": "test", "repos": [{"url": "u", "branc": "main"}], "applications": []}`,
+			want: []string{"unknown key repos[0].branc (did you mean branch?)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := decodeFormat(FormatJSON, []byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, problem := range schemaProblems(doc) {
+				got = append(got, problem.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("schemaProblems() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	properties := map[string]interface{}{"branch": nil, "commit": nil, "ref": nil, "url": nil}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "brnch", want: " (did you mean branch?)"},
+		{key: "comit", want: " (did you mean commit?)"},
+		{key: "rev", want: " (did you mean ref?)"},
+		{key: "repository", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := suggestKey(tt.key, properties); got != tt.want {
+				t.Errorf("suggestKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
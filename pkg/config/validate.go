@@ -0,0 +1,332 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a problem found in a config file. File, Line and Column are set when they are known
+type Problem struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// Path is the setting with the problem, e.g. applications[web].repos[1]
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+
+	path []pathElement
+}
+
+// String formats the problem as file:line:column: message
+func (p Problem) String() string {
+	switch {
+	case p.File == "":
+		return p.Message
+	case p.Line == 0:
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+	}
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].String()
+	}
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = problem.String()
+	}
+	return fmt.Sprintf("%d problems:\n  %s", len(e.Problems), strings.Join(lines, "\n  "))
+}
+
+// problemList collects the problems found during validation
+type problemList []Problem
+
+// add records a problem with the setting at path
+func (l *problemList) add(path []pathElement, format string, args ...interface{}) {
+	*l = append(*l, Problem{Path: describePath(path), Message: fmt.Sprintf(format, args...), path: path})
+}
+
+// err returns the problems as a ValidationError, or nil if there are none
+func (l problemList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: l}
+}
+
+// settingPath returns the path of a setting of a repository or application, e.g.
+// settingPath("applications", "web", 0, "scripts", "build") for applications[web].scripts.build
+func settingPath(list, name string, index int, keys ...string) []pathElement {
+	path := []pathElement{{key: list}, itemElement(name, index)}
+	for _, key := range keys {
+		path = append(path, pathElement{key: key})
+	}
+	return path
+}
+
+// itemElement is the path element of a list item: its name if it has one, otherwise its index
+func itemElement(name string, index int) pathElement {
+	if name == "" {
+		name = strconv.Itoa(index)
+	}
+	return pathElement{key: name, named: true, index: index}
+}
+
+// sourceFiles returns every file the configuration was loaded from, the base file first
+func (s *configSource) sourceFiles() []sourceFile {
+	files := append([]sourceFile{{path: s.path, doc: s.base, data: s.data}}, s.fragments...)
+	return append(files, s.local...)
+}
+
+// locate sets the file and position of problems found in the merged configuration: the file
+// that defines the most of the path of the setting, preferring the files merged last
+func (s *configSource) locate(problems []Problem) {
+	files := s.sourceFiles()
+	for i := range problems {
+		best, bestPath, bestDepth := files[0], problems[i].path, 0
+		for _, file := range files {
+			path, ok := s.filePath(file, problems[i].path)
+			if !ok {
+				continue
+			}
+			if depth := documentDepth(file.doc, path); depth >= bestDepth && depth > 0 {
+				best, bestPath, bestDepth = file, path, depth
+			}
+		}
+		problems[i].File = best.path
+		problems[i].Line, problems[i].Column = best.position(bestPath[:bestDepth])
+	}
+}
+
+// filePath returns the path of a setting of the configuration in one of the files it was
+// loaded from, or false if the setting cannot be in that file. A repository or application
+// is at its position among those of the file that defines it, and is found by name in the
+// local override files
+func (s *configSource) filePath(file sourceFile, path []pathElement) ([]pathElement, bool) {
+	if len(path) < 2 || !path[1].named {
+		return path, true
+	}
+	origins := s.files[path[0].key]
+	index := path[1].index
+	if index >= len(origins) || origins[index] != file.path {
+		for _, local := range s.local {
+			if local.path == file.path {
+				return path, true
+			}
+		}
+		return nil, false
+	}
+
+	first := index
+	for first > 0 && origins[first-1] == file.path {
+		first--
+	}
+	filePath := append([]pathElement{}, path...)
+	if path[1].key == strconv.Itoa(index) {
+		// An item without a name is known by its index
+		filePath[1].key = strconv.Itoa(index - first)
+	}
+	filePath[1].index = index - first
+	return filePath, true
+}
+
+// documentDepth returns how many elements of a path exist in a document
+func documentDepth(doc map[string]interface{}, path []pathElement) int {
+	var value interface{} = doc
+	for depth, element := range path {
+		switch container := value.(type) {
+		case map[string]interface{}:
+			child, exists := container[element.key]
+			if !exists || element.named {
+				return depth
+			}
+			value = child
+		case []interface{}:
+			index := listIndex(len(container), func(i int) string { return elementName(container[i]) }, element)
+			if index < 0 {
+				return depth
+			}
+			value = container[index]
+		default:
+			return depth
+		}
+	}
+	return len(path)
+}
+
+// listIndex finds the item of a list a path element refers to: the item with that name, the
+// one at the index of the element if several have it, or else the item at the index given
+// as its name. It returns -1 if there is none
+func listIndex(length int, name func(i int) string, element pathElement) int {
+	if !element.named {
+		return -1
+	}
+	found := -1
+	for i := 0; i < length; i++ {
+		if name(i) == element.key {
+			if i == element.index {
+				return i
+			}
+			if found < 0 {
+				found = i
+			}
+		}
+	}
+	if found >= 0 {
+		return found
+	}
+	if index, err := strconv.Atoi(element.key); err == nil && index >= 0 && index < length {
+		return index
+	}
+	return -1
+}
+
+// position returns the line and column of the setting at path in the file, or 0, 0 if they
+// are not known. Object members are located at their key
+func (f sourceFile) position(path []pathElement) (int, int) {
+	if len(path) == 0 || f.data == nil {
+		return 0, 0
+	}
+
+	switch FormatOf(f.path) {
+	case FormatJSON:
+		node, err := parseJSON(stripJSONC(f.data))
+		if err != nil {
+			return 0, 0
+		}
+		offset := node.start
+		for _, element := range path {
+			switch node.kind {
+			case '{':
+				member := node.memberNode(element.key)
+				if member == nil {
+					return lineColumn(f.data, offset)
+				}
+				node, offset = member.value, member.keyStart
+			case '[':
+				items := node.items
+				index := listIndex(len(items), func(i int) string {
+					if name := items[i].member("name"); name != nil {
+						return name.text
+					}
+					return ""
+				}, element)
+				if index < 0 {
+					return lineColumn(f.data, offset)
+				}
+				node, offset = items[index], items[index].start
+			default:
+				return lineColumn(f.data, offset)
+			}
+		}
+		return lineColumn(f.data, offset)
+
+	case FormatYAML:
+		var document yaml.Node
+		if err := yaml.Unmarshal(f.data, &document); err != nil || len(document.Content) == 0 {
+			return 0, 0
+		}
+		node := document.Content[0]
+		line, column := node.Line, node.Column
+		for _, element := range path {
+			switch node.Kind {
+			case yaml.MappingNode:
+				var found *yaml.Node
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == element.key {
+						line, column = node.Content[i].Line, node.Content[i].Column
+						found = node.Content[i+1]
+					}
+				}
+				if found == nil {
+					return line, column
+				}
+				node = found
+			case yaml.SequenceNode:
+				items := node.Content
+				index := listIndex(len(items), func(i int) string { return yamlName(items[i]) }, element)
+				if index < 0 {
+					return line, column
+				}
+				node = items[index]
+				line, column = node.Line, node.Column
+			default:
+				return line, column
+			}
+		}
+		return line, column
+
+	default:
+		// The TOML decoder does not report where keys are
+		return 0, 0
+	}
+}
+
+// memberNode returns the member of an object node with the given key, or nil
+func (n *jsonNode) memberNode(key string) *jsonMember {
+	for _, member := range n.members {
+		if member.key == key {
+			return member
+		}
+	}
+	return nil
+}
+
+// yamlName returns the "name" of a YAML mapping node, or ""
+func yamlName(node *yaml.Node) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == "name" {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// yamlErrorLine matches the line number in YAML parse errors
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// tomlErrorPrefix matches the line number and key that TOML parse errors start with
+var tomlErrorPrefix = regexp.MustCompile(`^toml: line \d+( \(last key "[^"]*"\))?: `)
+
+// parseProblem turns an error parsing a config file into a ValidationError with the position
+// of the error, when the parser reports it
+func parseProblem(file string, data []byte, err error) error {
+	problem := Problem{File: file, Message: err.Error()}
+
+	var syntaxError *json.SyntaxError
+	var parseError toml.ParseError
+	var typeError *yaml.TypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		// The offset is just after the character that could not be parsed
+		problem.Line, problem.Column = lineColumn(data, max(int(syntaxError.Offset)-1, 0))
+	case errors.As(err, &parseError):
+		problem.Line, problem.Column = lineColumn(data, parseError.Position.Start)
+		problem.Message = tomlErrorPrefix.ReplaceAllString(parseError.Error(), "")
+	case errors.As(err, &typeError) && len(typeError.Errors) > 0:
+		problem.Message = typeError.Errors[0]
+	}
+	if match := yamlErrorLine.FindStringSubmatch(problem.Message); match != nil {
+		problem.Line, _ = strconv.Atoi(match[1])
+		problem.Column = 1
+		problem.Message = match[2]
+	}
+	return &ValidationError{Problems: []Problem{problem}}
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// loadProblems loads the config file with the given name of a project and returns its
+// problems, formatted
+func loadProblems(t *testing.T, files map[string]string, name string) []string {
+	t.Helper()
+	_, err := LoadConfig(filepath.Join(filepath.Dir(writeProject(t, files)), name))
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		t.Fatalf("LoadConfig() error = %v, want a ValidationError", err)
+	}
+	problems := make([]string, len(validationError.Problems))
+	for i, problem := range validationError.Problems {
+		problems[i] = problem.String()
+	}
+	return problems
+}
+
+func TestValidateLocatesDuplicates(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "duplicate in the same file",
+			files: map[string]string{"mess.json": `{
+  "name": "test",
+  "repos": [
+    {"name": "a", "url": "https://example.com/a.git"},
+    {"name": "a", "url": ""}
+  ],
+  "applications": []
+}`},
+			want: []string{
+				"mess.json:5:19: repo URL cannot be empty for repo: a",
+				"mess.json:5:5: duplicate repo name: a (defined twice in mess.json)",
+			},
+		},
+		{
+			name: "first of two is invalid",
+			files: map[string]string{"mess.json": `{
+  "name": "test",
+  "repos": [
+    {"name": "a", "url": ""},
+    {"name": "a", "url": "https://example.com/a.git"}
+  ],
+  "applications": []
+}`},
+			want: []string{
+				"mess.json:4:19: repo URL cannot be empty for repo: a",
+				"mess.json:5:5: duplicate repo name: a (defined twice in mess.json)",
+			},
+		},
+		{
+			name: "duplicate in an included file",
+			files: map[string]string{
+				"mess.json": `{
+  "name": "test",
+  "include": ["team.json"],
+  "repos": [
+    {"name": "a", "url": "https://example.com/a.git"}
+  ],
+  "applications": [
+    {"name": "web", "repos": ["a"], "scripts": {}}
+  ]
+}`,
+				"team.json": `{
+  "applications": [
+    {"name": "api", "repos": [], "scripts": {}},
+    {"name": "web", "repos": [], "scripts": {}}
+  ]
+}`,
+			},
+			want: []string{
+				"team.json:4:5: duplicate application name: web (defined in mess.json and team.json)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadProblems(t, tt.files, "mess.json"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems =\n  %q\nwant\n  %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemPositions(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "json",
+			files: map[string]string{"mess.json": `{
+  "name": "test",
+  "repos": [
+    {"name": "a", "url": "https://example.com/a.git", "branc": "main"}
+  ],
+  "applications": [
+    {"name": "web", "repos": ["a", "b"], "scripts": {}}
+  ]
+}`},
+			want: []string{
+				"mess.json:4:55: unknown key repos[a].branc (did you mean branch?)",
+				"mess.json:7:36: application web references non-existent repo: b",
+			},
+		},
+		{
+			name: "jsonc",
+			files: map[string]string{"mess.json": `{
+  // The project
+  "name": "test",
+  "repos": [
+    {"name": "a", "url": "https://example.com/a.git", "branc": "main"}, // typo
+  ],
+  "applications": [
+    {"name": "web", "repos": ["a", "b"], "scripts": {}},
+  ],
+}`},
+			want: []string{
+				"mess.json:5:55: unknown key repos[a].branc (did you mean branch?)",
+				"mess.json:8:36: application web references non-existent repo: b",
+			},
+		},
+		{
+			name: "yaml",
+			files: map[string]string{"mess.yaml": `name: test
+repos:
+  - name: a
+    url: https://example.com/a.git
+    branc: main
+applications:
+  - name: web
+    repos: [a, b]
+    scripts: {}
+`},
+			want: []string{
+				"mess.yaml:5:5: unknown key repos[a].branc (did you mean branch?)",
+				"mess.yaml:8:16: application web references non-existent repo: b",
+			},
+		},
+		{
+			name: "toml",
+			files: map[string]string{"mess.toml": `name = "test"
+
+[[repos]]
+name = "a"
+url = "https://example.com/a.git"
+branc = "main"
+
+[[applications]]
+name = "web"
+repos = ["a", "b"]
+[applications.scripts]
+`},
+			want: []string{
+				"mess.toml: unknown key repos[a].branc (did you mean branch?)",
+				"mess.toml: application web references non-existent repo: b",
+			},
+		},
+		{
+			name: "local override file",
+			files: map[string]string{
+				"mess.json": `{
+  "name": "test",
+  "repos": [{"name": "a", "url": "https://example.com/a.git"}],
+  "applications": [{"name": "web", "repos": ["a"], "scripts": {}}]
+}`,
+				"mess.local.json": `{
+  "applications": [
+    {"name": "web", "repos": ["a", "b"]}
+  ]
+}`,
+			},
+			want: []string{
+				"mess.local.json:3:36: application web references non-existent repo: b",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "mess." + tt.name
+			if _, ok := tt.files[name]; !ok {
+				name = "mess.json"
+			}
+			if got := loadProblems(t, tt.files, name); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems =\n  %q\nwant\n  %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes
+const diffContext = 3
+
+// Diff returns a unified diff of two texts, or "" if they are equal
+func Diff(oldName, newName string, oldText, newText []byte) string {
+	a := splitLines(string(oldText))
+	b := splitLines(string(newText))
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table into a list of edits: ' ' keeps, '-' removes and '+' adds a line
+	type edit struct {
+		op   byte
+		line string
+		// oldLine and newLine are the line numbers before the edit, counted from 0
+		oldLine, newLine int
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		default:
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		}
+	}
+
+	// Group changes that are close to each other into hunks, with context lines around them
+	var out strings.Builder
+	for start := 0; start < len(edits); start++ {
+		if edits[start].op == ' ' {
+			continue
+		}
+		end := start + 1
+		for next := end; next < len(edits) && next-end <= 2*diffContext; next++ {
+			if edits[next].op != ' ' {
+				end = next + 1
+			}
+		}
+		first, last := max(start-diffContext, 0), min(end+diffContext, len(edits))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		oldCount, newCount := 0, 0
+		for _, e := range edits[first:last] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", edits[first].oldLine+1, oldCount, edits[first].newLine+1, newCount)
+		for _, e := range edits[first:last] {
+			fmt.Fprintf(&out, "%c%s\n", e.op, e.line)
+		}
+		start = last - 1
+	}
+	return out.String()
+}
+
+// splitLines splits a text into lines, without the final newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
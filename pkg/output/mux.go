@@ -0,0 +1,155 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// ANSI colors assigned to labels in order of first use
+var palette = []string{
+	"\033[36m", // cyan
+	"\033[33m", // yellow
+	"\033[32m", // green
+	"\033[35m", // magenta
+	"\033[34m", // blue
+	"\033[91m", // bright red
+}
+
+const colorReset = "\033[0m"
+
+var (
+	colorMu     sync.Mutex
+	noColor     bool
+	labelColors = make(map[string]string)
+)
+
+// SetNoColor disables colored labels, e.g. for the --no-color flag
+func SetNoColor(disabled bool) {
+	colorMu.Lock()
+	defer colorMu.Unlock()
+	noColor = disabled
+}
+
+// colorEnabled reports whether labels written to out should be colored: colors
+// are only used for terminals and can be disabled with SetNoColor or NO_COLOR
+func colorEnabled(out io.Writer) bool {
+	colorMu.Lock()
+	disabled := noColor
+	colorMu.Unlock()
+	if disabled || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// labelColor returns the color of a label. A label keeps its color across
+// multiplexers, so its stdout and stderr lines look the same
+func labelColor(label string) string {
+	colorMu.Lock()
+	defer colorMu.Unlock()
+
+	color, exists := labelColors[label]
+	if !exists {
+		color = palette[len(labelColors)%len(palette)]
+		labelColors[label] = color
+	}
+	return color
+}
+
+// Mux serializes the output of concurrent processes onto a single writer.
+// Every process writes through its own LineWriter, which buffers output until
+// a full line is available so lines from different processes never interleave
+type Mux struct {
+	mu    sync.Mutex
+	out   io.Writer
+	color bool
+}
+
+// NewMux creates a multiplexer that writes to out
+func NewMux(out io.Writer) *Mux {
+	return &Mux{out: out, color: colorEnabled(out)}
+}
+
+var (
+	stdOnce   sync.Once
+	stdoutMux *Mux
+	stderrMux *Mux
+)
+
+// Stdout returns the multiplexer shared by everything that writes prefixed lines to os.Stdout
+func Stdout() *Mux {
+	stdOnce.Do(initStd)
+	return stdoutMux
+}
+
+// Stderr returns the multiplexer shared by everything that writes prefixed lines to os.Stderr
+func Stderr() *Mux {
+	stdOnce.Do(initStd)
+	return stderrMux
+}
+
+// initStd creates the shared multiplexers once the color settings are known
+func initStd() {
+	stdoutMux = NewMux(os.Stdout)
+	stderrMux = NewMux(os.Stderr)
+}
+
+// Writer returns a line-buffered writer that prefixes every line with the label
+func (m *Mux) Writer(label string) *LineWriter {
+	prefix := "[" + label + "] "
+	if m.color {
+		prefix = labelColor(label) + "[" + label + "]" + colorReset + " "
+	}
+	return &LineWriter{mux: m, prefix: []byte(prefix)}
+}
+
+// LineWriter is a line-buffered writer created by Mux.Writer
+type LineWriter struct {
+	mux    *Mux
+	prefix []byte
+	buf    bytes.Buffer
+}
+
+// Write buffers p and writes every complete line to the multiplexer
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		if err := w.writeLine(w.buf.Next(i + 1)); err != nil {
+			return len(p), err
+		}
+	}
+}
+
+// Close writes any buffered partial line, terminating it with a newline
+func (w *LineWriter) Close() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	line := append(w.buf.Bytes(), '\n')
+	w.buf.Reset()
+	return w.writeLine(line)
+}
+
+// writeLine writes a single prefixed line with one write while holding the multiplexer lock
+func (w *LineWriter) writeLine(line []byte) error {
+	w.mux.mu.Lock()
+	defer w.mux.mu.Unlock()
+
+	buf := make([]byte, 0, len(w.prefix)+len(line))
+	buf = append(append(buf, w.prefix...), line...)
+	_, err := w.mux.out.Write(buf)
+	return err
+}
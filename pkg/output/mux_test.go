@@ -0,0 +1,121 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lineRecorder records the writes made to it. It is not safe for concurrent use, so
+// unserialized writes are caught by the race detector
+type lineRecorder struct {
+	writes []string
+}
+
+func (r *lineRecorder) Write(p []byte) (int, error) {
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func TestMuxConcurrentWritersDoNotInterleave(t *testing.T) {
+	const (
+		writers = 8
+		lines   = 200
+	)
+	recorder := &lineRecorder{}
+	mux := NewMux(recorder)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			label := fmt.Sprintf("repo%d", w)
+			out := mux.Writer(label)
+			defer out.Close()
+
+			// Write every line in small chunks that split it at different places, the way
+			// a process writes to a pipe
+			var text bytes.Buffer
+			for i := 0; i < lines; i++ {
+				fmt.Fprintf(&text, "%s line %d %s\n", label, i, strings.Repeat("x", i%17))
+			}
+			data := text.Bytes()
+			for chunk := 1 + w%5; len(data) > 0; chunk = chunk%7 + 1 {
+				n := min(chunk, len(data))
+				if _, err := out.Write(data[:n]); err != nil {
+					t.Error(err)
+					return
+				}
+				data = data[n:]
+			}
+			// A last line without a newline is completed by Close
+			fmt.Fprintf(out, "%s partial", label)
+		}(w)
+	}
+	wg.Wait()
+
+	next := make(map[string]int)
+	for _, write := range recorder.writes {
+		if strings.Count(write, "\n") != 1 || !strings.HasSuffix(write, "\n") {
+			t.Fatalf("write %q is not exactly one line", write)
+		}
+		var label string
+		if _, err := fmt.Sscanf(write, "[%s", &label); err != nil {
+			t.Fatalf("write %q has no label prefix", write)
+		}
+		label = strings.TrimSuffix(label, "]")
+
+		want := fmt.Sprintf("[%s] %s line %d %s\n", label, label, next[label], strings.Repeat("x", next[label]%17))
+		if next[label] == lines {
+			want = fmt.Sprintf("[%s] %s partial\n", label, label)
+		}
+		if write != want {
+			t.Fatalf("write = %q, want %q", write, want)
+		}
+		next[label]++
+	}
+
+	for w := 0; w < writers; w++ {
+		if label := fmt.Sprintf("repo%d", w); next[label] != lines+1 {
+			t.Errorf("%s wrote %d lines, want %d", label, next[label], lines+1)
+		}
+	}
+}
+
+func TestLineWriterPrefix(t *testing.T) {
+	tests := []struct {
+		name  string
+		color bool
+		want  string
+	}{
+		{name: "plain", want: "[api] hello\n"},
+		{name: "color", color: true, want: labelColor("api") + "[api]" + colorReset + " hello\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			mux := &Mux{out: &buf, color: test.color}
+			out := mux.Writer("api")
+			fmt.Fprint(out, "hel")
+			if buf.Len() != 0 {
+				t.Fatalf("partial line was written before the newline: %q", buf.String())
+			}
+			fmt.Fprint(out, "lo\n")
+			if err := out.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != test.want {
+				t.Errorf("output = %q, want %q", buf.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	if colorEnabled(&bytes.Buffer{}) {
+		t.Error("colorEnabled is true for a writer that is not a terminal")
+	}
+}
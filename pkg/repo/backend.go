@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// GitBackend performs the git operations mess needs on repository checkouts
+type GitBackend interface {
+	// Clone clones url into dir, writing progress to out
+	Clone(ctx context.Context, url, dir string, opts CloneOptions, out io.Writer) error
+	// Fetch fetches branches and tags from the origin remote
+	Fetch(ctx context.Context, dir string) error
+	// Checkout checks out a branch, tag or commit, fetching it from origin if needed
+	Checkout(ctx context.Context, dir, revision string) error
+	// Status reports the working tree and upstream state of a checkout
+	Status(ctx context.Context, dir string) (*WorktreeStatus, error)
+	// CurrentRef returns the checked out branch (empty when HEAD is detached) and commit
+	CurrentRef(ctx context.Context, dir string) (branch string, commit string, err error)
+	// ResolveRevision returns the commit a branch, tag or commit name points to
+	ResolveRevision(ctx context.Context, dir, revision string) (string, error)
+	// FastForward fast-forwards the current branch to its upstream branch.
+	// It returns ErrNoUpstream if the branch does not track one
+	FastForward(ctx context.Context, dir string) error
+	// IsRepository reports whether dir is the root of a git checkout
+	IsRepository(dir string) bool
+	// Run executes a git command line in dir, as delegated by 'mess repo <name> <git-command>'
+	Run(ctx context.Context, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error
+}
+
+// CloneOptions holds the repository specific options of a clone
+type CloneOptions struct {
+	// Branch is cloned instead of the remote's default branch if set
+	Branch string
+	// Params are the clone_params of the repository definition
+	Params []string
+}
+
+// WorktreeStatus describes the working tree and upstream state of a checkout
+type WorktreeStatus struct {
+	Dirty     int
+	RemoteURL string
+	Upstream  string
+	Ahead     int
+	Behind    int
+}
+
+// ErrNoUpstream is returned by GitBackend.FastForward when the current branch has no upstream
+var ErrNoUpstream = errors.New("branch has no upstream")
+
+// Names of the built-in git backends
+const (
+	ExecBackendName  = "exec"
+	GoGitBackendName = "go-git"
+)
+
+var (
+	backendMu sync.RWMutex
+	backend   GitBackend = &ExecBackend{}
+)
+
+// NewBackend creates the built-in backend with the given name. An empty name selects the exec backend
+func NewBackend(name string) (GitBackend, error) {
+	switch name {
+	case "", ExecBackendName:
+		return &ExecBackend{}, nil
+	case GoGitBackendName:
+		return &GoGitBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unknown git backend: %s (available: %s, %s)", name, ExecBackendName, GoGitBackendName)
+	}
+}
+
+// Backend returns the git backend used by the repository functions
+func Backend() GitBackend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return backend
+}
+
+// SetBackend replaces the git backend used by the repository functions
+func SetBackend(b GitBackend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+}
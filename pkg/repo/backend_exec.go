@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ExecBackend implements GitBackend by running the git binary
+type ExecBackend struct{}
+
+// Clone implements GitBackend
+func (b *ExecBackend) Clone(ctx context.Context, url, dir string, opts CloneOptions, out io.Writer) error {
+	// Build git clone command with optional clone_params
+	args := []string{"clone"}
+	args = append(args, opts.Params...)
+	if opts.Branch != "" {
+		args = append(args, "--branch", opts.Branch)
+	}
+	args = append(args, url, dir)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// Fetch implements GitBackend
+func (b *ExecBackend) Fetch(ctx context.Context, dir string) error {
+	_, err := runGit(ctx, dir, "fetch", "--quiet", "--tags", "origin")
+	return err
+}
+
+// Checkout implements GitBackend
+func (b *ExecBackend) Checkout(ctx context.Context, dir, revision string) error {
+	if _, err := runGit(ctx, dir, "checkout", "--quiet", revision); err == nil {
+		return nil
+	}
+
+	// The revision may not be available locally, e.g. after a shallow clone
+	if _, err := runGit(ctx, dir, "fetch", "--quiet", "origin", revision); err != nil {
+		return err
+	}
+	_, err := runGit(ctx, dir, "checkout", "--quiet", "FETCH_HEAD")
+	return err
+}
+
+// Status implements GitBackend
+func (b *ExecBackend) Status(ctx context.Context, dir string) (*WorktreeStatus, error) {
+	status := &WorktreeStatus{}
+
+	// Count modified and untracked files
+	porcelain, err := runGit(ctx, dir, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	if porcelain != "" {
+		status.Dirty = len(strings.Split(porcelain, "\n"))
+	}
+
+	if remoteURL, err := runGit(ctx, dir, "remote", "get-url", "origin"); err == nil {
+		status.RemoteURL = remoteURL
+	}
+
+	// Count commits ahead of and behind the upstream branch, if there is one
+	upstream, err := runGit(ctx, dir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+	if err != nil {
+		return status, nil
+	}
+	status.Upstream = upstream
+
+	counts, err := runGit(ctx, dir, "rev-list", "--left-right", "--count", "HEAD...@{upstream}")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Sscanf(counts, "%d %d", &status.Ahead, &status.Behind); err != nil {
+		return nil, fmt.Errorf("failed to parse ahead/behind counts %q: %v", counts, err)
+	}
+
+	return status, nil
+}
+
+// CurrentRef implements GitBackend
+func (b *ExecBackend) CurrentRef(ctx context.Context, dir string) (string, string, error) {
+	commit, err := runGit(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+
+	branch, err := runGit(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	if branch == "HEAD" {
+		branch = ""
+	}
+
+	return branch, commit, nil
+}
+
+// ResolveRevision implements GitBackend
+func (b *ExecBackend) ResolveRevision(ctx context.Context, dir, revision string) (string, error) {
+	return runGit(ctx, dir, "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+}
+
+// FastForward implements GitBackend
+func (b *ExecBackend) FastForward(ctx context.Context, dir string) error {
+	if _, err := runGit(ctx, dir, "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		return ErrNoUpstream
+	}
+	_, err := runGit(ctx, dir, "merge", "--ff-only", "--quiet", "@{upstream}")
+	return err
+}
+
+// IsRepository implements GitBackend
+func (b *ExecBackend) IsRepository(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// Run implements GitBackend
+func (b *ExecBackend) Run(ctx context.Context, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// runGit executes a git command in the given directory and returns its trimmed output
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// FakeBackend is a GitBackend for tests. It redirects remote URLs to local
+// (typically bare) repositories, records every call and delegates the actual
+// work to another backend, the pure Go one by default, so tests need neither
+// network access nor a git binary
+type FakeBackend struct {
+	// Remotes maps the URLs used in mess.json to local repository paths
+	Remotes map[string]string
+	// Delegate performs the operations; GoGitBackend is used if nil
+	Delegate GitBackend
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// NewFakeBackend creates a fake backend that serves the given URL to path mapping
+func NewFakeBackend(remotes map[string]string) *FakeBackend {
+	return &FakeBackend{Remotes: remotes}
+}
+
+// Calls returns the operations performed so far, e.g. "clone https://example.com/a.git"
+func (b *FakeBackend) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.calls...)
+}
+
+// record appends an operation to the call log
+func (b *FakeBackend) record(op string, args ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, strings.TrimSpace(op+" "+strings.Join(args, " ")))
+}
+
+// delegate returns the backend that performs the operations
+func (b *FakeBackend) delegate() GitBackend {
+	if b.Delegate != nil {
+		return b.Delegate
+	}
+	return &GoGitBackend{}
+}
+
+// Clone implements GitBackend
+func (b *FakeBackend) Clone(ctx context.Context, url, dir string, opts CloneOptions, out io.Writer) error {
+	b.record("clone", url)
+	local, ok := b.Remotes[url]
+	if !ok {
+		return fmt.Errorf("fake backend has no repository for %s", url)
+	}
+	return b.delegate().Clone(ctx, local, dir, opts, out)
+}
+
+// Fetch implements GitBackend
+func (b *FakeBackend) Fetch(ctx context.Context, dir string) error {
+	b.record("fetch", dir)
+	return b.delegate().Fetch(ctx, dir)
+}
+
+// Checkout implements GitBackend
+func (b *FakeBackend) Checkout(ctx context.Context, dir, revision string) error {
+	b.record("checkout", dir, revision)
+	return b.delegate().Checkout(ctx, dir, revision)
+}
+
+// Status implements GitBackend. The origin remote, which is the local repository, is
+// reported as the URL it stands for
+func (b *FakeBackend) Status(ctx context.Context, dir string) (*WorktreeStatus, error) {
+	b.record("status", dir)
+	status, err := b.delegate().Status(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	for url, local := range b.Remotes {
+		if status.RemoteURL == local {
+			status.RemoteURL = url
+		}
+	}
+	return status, nil
+}
+
+// CurrentRef implements GitBackend
+func (b *FakeBackend) CurrentRef(ctx context.Context, dir string) (string, string, error) {
+	b.record("current-ref", dir)
+	return b.delegate().CurrentRef(ctx, dir)
+}
+
+// ResolveRevision implements GitBackend
+func (b *FakeBackend) ResolveRevision(ctx context.Context, dir, revision string) (string, error) {
+	b.record("resolve", dir, revision)
+	return b.delegate().ResolveRevision(ctx, dir, revision)
+}
+
+// FastForward implements GitBackend
+func (b *FakeBackend) FastForward(ctx context.Context, dir string) error {
+	b.record("fast-forward", dir)
+	return b.delegate().FastForward(ctx, dir)
+}
+
+// IsRepository implements GitBackend
+func (b *FakeBackend) IsRepository(dir string) bool {
+	return b.delegate().IsRepository(dir)
+}
+
+// Run implements GitBackend
+func (b *FakeBackend) Run(ctx context.Context, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	b.record("run", append([]string{dir}, args...)...)
+	return b.delegate().Run(ctx, dir, args, stdin, stdout, stderr)
+}
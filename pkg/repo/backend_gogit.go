@@ -0,0 +1,427 @@
+package repo
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// GoGitBackend implements GitBackend in pure Go, so mess works on machines without git
+type GoGitBackend struct{}
+
+// Clone implements GitBackend
+func (b *GoGitBackend) Clone(ctx context.Context, url, dir string, opts CloneOptions, out io.Writer) error {
+	cloneOptions, err := goGitCloneOptions(url, opts, out)
+	if err != nil {
+		return err
+	}
+
+	_, err = git.PlainCloneContext(ctx, dir, false, cloneOptions)
+	return err
+}
+
+// Fetch implements GitBackend
+func (b *GoGitBackend) Fetch(ctx context.Context, dir string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	return fetchOrigin(ctx, r)
+}
+
+// Checkout implements GitBackend
+func (b *GoGitBackend) Checkout(ctx context.Context, dir, revision string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	// Local branch
+	branchRef := plumbing.NewBranchReferenceName(revision)
+	if _, err := r.Reference(branchRef, true); err == nil {
+		return w.Checkout(&git.CheckoutOptions{Branch: branchRef})
+	}
+
+	// Remote branch: create a local branch tracking it, like git checkout does
+	if ref, err := r.Reference(plumbing.NewRemoteReferenceName("origin", revision), true); err == nil {
+		if err := w.Checkout(&git.CheckoutOptions{Branch: branchRef, Hash: ref.Hash(), Create: true}); err != nil {
+			return err
+		}
+		return r.CreateBranch(&gitconfig.Branch{Name: revision, Remote: "origin", Merge: branchRef})
+	}
+
+	// Tag or commit, fetching it from origin when it is not available locally
+	hash, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		if err := fetchOrigin(ctx, r); err != nil {
+			return err
+		}
+		if hash, err = r.ResolveRevision(plumbing.Revision(revision)); err != nil {
+			return fmt.Errorf("revision %s not found: %v", revision, err)
+		}
+	}
+	return w.Checkout(&git.CheckoutOptions{Hash: *hash})
+}
+
+// Status implements GitBackend
+func (b *GoGitBackend) Status(ctx context.Context, dir string) (*WorktreeStatus, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &WorktreeStatus{}
+
+	// Count modified and untracked files
+	fileStatus, err := w.Status()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range fileStatus {
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			status.Dirty++
+		}
+	}
+
+	if remote, err := r.Remote("origin"); err == nil && len(remote.Config().URLs) > 0 {
+		status.RemoteURL = remote.Config().URLs[0]
+	}
+
+	// Count commits ahead of and behind the upstream branch, if there is one
+	head, err := r.Head()
+	if err != nil {
+		return nil, err
+	}
+	upstream := upstreamReference(r, head)
+	if upstream == "" {
+		return status, nil
+	}
+	upstreamRef, err := r.Reference(upstream, true)
+	if err != nil {
+		return status, nil
+	}
+	status.Upstream = upstream.Short()
+
+	if status.Ahead, status.Behind, err = aheadBehind(r, head.Hash(), upstreamRef.Hash()); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// CurrentRef implements GitBackend
+func (b *GoGitBackend) CurrentRef(ctx context.Context, dir string) (string, string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", "", err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", "", err
+	}
+
+	branch := ""
+	if head.Name().IsBranch() {
+		branch = head.Name().Short()
+	}
+	return branch, head.Hash().String(), nil
+}
+
+// ResolveRevision implements GitBackend
+func (b *GoGitBackend) ResolveRevision(ctx context.Context, dir, revision string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", err
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return "", err
+	}
+	return hash.String(), nil
+}
+
+// FastForward implements GitBackend
+func (b *GoGitBackend) FastForward(ctx context.Context, dir string) error {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return err
+	}
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+	upstream := upstreamReference(r, head)
+	if upstream == "" {
+		return ErrNoUpstream
+	}
+	upstreamRef, err := r.Reference(upstream, true)
+	if err != nil {
+		return ErrNoUpstream
+	}
+	if upstreamRef.Hash() == head.Hash() {
+		return nil
+	}
+
+	headCommit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+	upstreamCommit, err := r.CommitObject(upstreamRef.Hash())
+	if err != nil {
+		return err
+	}
+	canFastForward, err := headCommit.IsAncestor(upstreamCommit)
+	if err != nil {
+		return err
+	}
+	if !canFastForward {
+		return fmt.Errorf("branch %s has diverged from %s", head.Name().Short(), upstream.Short())
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	return w.Reset(&git.ResetOptions{Commit: upstreamRef.Hash(), Mode: git.MergeReset})
+}
+
+// IsRepository implements GitBackend
+func (b *GoGitBackend) IsRepository(dir string) bool {
+	_, err := git.PlainOpen(dir)
+	return err == nil
+}
+
+// Run implements GitBackend. Only the status, fetch, pull and checkout commands are supported
+func (b *GoGitBackend) Run(ctx context.Context, dir string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no git command given")
+	}
+
+	switch {
+	case args[0] == "status" && len(args) == 1:
+		r, err := git.PlainOpen(dir)
+		if err != nil {
+			return err
+		}
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+		status, err := w.Status()
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(stdout, status.String())
+		return err
+	case args[0] == "fetch" && len(args) == 1:
+		return b.Fetch(ctx, dir)
+	case args[0] == "pull" && len(args) == 1:
+		if err := b.Fetch(ctx, dir); err != nil {
+			return err
+		}
+		return b.FastForward(ctx, dir)
+	case args[0] == "checkout" && len(args) == 2:
+		return b.Checkout(ctx, dir, args[1])
+	default:
+		return fmt.Errorf("'git %s' is not supported by the %s backend, use --git-backend %s",
+			strings.Join(args, " "), GoGitBackendName, ExecBackendName)
+	}
+}
+
+// goGitCloneOptions translates clone_params to go-git clone options
+func goGitCloneOptions(url string, opts CloneOptions, out io.Writer) (*git.CloneOptions, error) {
+	cloneOptions := &git.CloneOptions{URL: url, Progress: out}
+
+	params := opts.Params
+	for i := 0; i < len(params); i++ {
+		name, value, hasValue := strings.Cut(params[i], "=")
+
+		// Parameters that take a value accept both --name=value and --name value
+		takeValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(params) {
+				return "", fmt.Errorf("clone parameter %s requires a value", name)
+			}
+			i++
+			return params[i], nil
+		}
+
+		switch name {
+		case "--depth":
+			value, err := takeValue()
+			if err != nil {
+				return nil, err
+			}
+			depth, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid clone parameter --depth %s", value)
+			}
+			cloneOptions.Depth = depth
+		case "--branch", "-b":
+			value, err := takeValue()
+			if err != nil {
+				return nil, err
+			}
+			cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(value)
+		case "--single-branch":
+			cloneOptions.SingleBranch = true
+		case "--no-tags":
+			cloneOptions.Tags = git.NoTags
+		case "--recurse-submodules", "--recursive":
+			cloneOptions.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+		case "--shallow-submodules":
+			cloneOptions.ShallowSubmodules = true
+		case "--quiet", "-q":
+			cloneOptions.Progress = nil
+		default:
+			return nil, fmt.Errorf("clone parameter %s is not supported by the %s backend", params[i], GoGitBackendName)
+		}
+	}
+
+	if opts.Branch != "" {
+		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(opts.Branch)
+	}
+
+	return cloneOptions, nil
+}
+
+// fetchOrigin fetches branches and tags from the origin remote
+func fetchOrigin(ctx context.Context, r *git.Repository) error {
+	err := r.FetchContext(ctx, &git.FetchOptions{RemoteName: "origin", Tags: git.AllTags})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+// upstreamReference returns the remote branch tracked by the checked out branch, if any
+func upstreamReference(r *git.Repository, head *plumbing.Reference) plumbing.ReferenceName {
+	if !head.Name().IsBranch() {
+		return ""
+	}
+	branch, err := r.Branch(head.Name().Short())
+	if err != nil || branch.Remote == "" || branch.Merge == "" {
+		return ""
+	}
+	return plumbing.NewRemoteReferenceName(branch.Remote, branch.Merge.Short())
+}
+
+// aheadBehind counts the commits reachable from local but not from upstream, and the other
+// way around. Both histories are walked together, newest commits first, until every commit
+// left to visit is reachable from both, so only the commits since they diverged are read
+func aheadBehind(r *git.Repository, local, upstream plumbing.Hash) (ahead, behind int, err error) {
+	const fromLocal, fromUpstream, fromBoth = 1, 2, 3
+	flags := make(map[plumbing.Hash]int)
+	walked := make(map[plumbing.Hash]*object.Commit)
+	queued := make(map[plumbing.Hash]bool)
+	queue := &commitQueue{}
+
+	// mark records that a commit is reachable from a side and passes that on to its parents
+	var mark func(hash plumbing.Hash, flag int) error
+	mark = func(hash plumbing.Hash, flag int) error {
+		if flags[hash]&flag == flag {
+			return nil
+		}
+		if commit, exists := walked[hash]; exists {
+			// Reached from the other side later than its own, e.g. when commit dates are
+			// equal: its ancestors are marked right away, as the walk will not get to them again
+			flags[hash] |= flag
+			for _, parent := range commit.ParentHashes {
+				if err := mark(parent, flags[hash]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if queued[hash] {
+			flags[hash] |= flag
+			return nil
+		}
+
+		commit, err := r.CommitObject(hash)
+		if errors.Is(err, plumbing.ErrObjectNotFound) && len(flags) > 0 {
+			// The history of shallow clones ends early
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		flags[hash] |= flag
+		queued[hash] = true
+		heap.Push(queue, commit)
+		return nil
+	}
+	if err := mark(local, fromLocal); err != nil {
+		return 0, 0, err
+	}
+	if err := mark(upstream, fromUpstream); err != nil {
+		return 0, 0, err
+	}
+
+	for queue.Len() > 0 && !queue.reachableFromBoth(flags, fromBoth) {
+		commit := heap.Pop(queue).(*object.Commit)
+		delete(queued, commit.Hash)
+		walked[commit.Hash] = commit
+		for _, parent := range commit.ParentHashes {
+			if err := mark(parent, flags[commit.Hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	for _, flag := range flags {
+		switch flag {
+		case fromLocal:
+			ahead++
+		case fromUpstream:
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
+
+// commitQueue is a priority queue of commits, newest first
+type commitQueue []*object.Commit
+
+func (q commitQueue) Len() int { return len(q) }
+func (q commitQueue) Less(i, j int) bool {
+	return q[i].Committer.When.After(q[j].Committer.When)
+}
+func (q commitQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*object.Commit)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	commit := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return commit
+}
+
+// reachableFromBoth reports whether every queued commit has all the given flags, in which
+// case so do all their ancestors
+func (q commitQueue) reachableFromBoth(flags map[plumbing.Hash]int, both int) bool {
+	for _, commit := range q {
+		if flags[commit.Hash] != both {
+			return false
+		}
+	}
+	return true
+}
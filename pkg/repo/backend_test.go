@@ -0,0 +1,271 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// testRemote is a bare repository on disk that tests clone from, with a working
+// repository that creates its commits
+type testRemote struct {
+	t    *testing.T
+	dir  string
+	work *git.Repository
+	// workDir is the directory of the working repository
+	workDir string
+}
+
+// newTestRemote creates an empty bare repository whose default branch is main
+func newTestRemote(t *testing.T) *testRemote {
+	t.Helper()
+	root := t.TempDir()
+	remote := &testRemote{t: t, dir: filepath.Join(root, "remote.git"), workDir: filepath.Join(root, "work")}
+
+	main := git.InitOptions{DefaultBranch: plumbing.NewBranchReferenceName("main")}
+	if _, err := git.PlainInitWithOptions(remote.dir, &git.PlainInitOptions{InitOptions: main, Bare: true}); err != nil {
+		t.Fatalf("init bare repository: %v", err)
+	}
+	work, err := git.PlainInitWithOptions(remote.workDir, &git.PlainInitOptions{InitOptions: main})
+	if err != nil {
+		t.Fatalf("init working repository: %v", err)
+	}
+	if _, err := work.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{remote.dir}}); err != nil {
+		t.Fatalf("add remote: %v", err)
+	}
+	remote.work = work
+	return remote
+}
+
+// commit commits a change to the main branch of the remote and returns its hash
+func (r *testRemote) commit(message string) string {
+	r.t.Helper()
+	if err := os.WriteFile(filepath.Join(r.workDir, "file.txt"), []byte(message+"\n"), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+	worktree, err := r.work.Worktree()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if _, err := worktree.Add("file.txt"); err != nil {
+		r.t.Fatal(err)
+	}
+	signature := &object.Signature{Name: "mess", Email: "mess@example.com", When: time.Now()}
+	hash, err := worktree.Commit(message, &git.CommitOptions{Author: signature})
+	if err != nil {
+		r.t.Fatalf("commit: %v", err)
+	}
+
+	err = r.work.Push(&git.PushOptions{RemoteName: "origin", RefSpecs: []gitconfig.RefSpec{"refs/heads/main:refs/heads/main"}})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		r.t.Fatalf("push: %v", err)
+	}
+	return hash.String()
+}
+
+// testBackends returns the built-in backends that can run here: the exec backend needs git
+func testBackends(t *testing.T) map[string]GitBackend {
+	backends := map[string]GitBackend{GoGitBackendName: &GoGitBackend{}}
+	if _, err := exec.LookPath("git"); err == nil {
+		backends[ExecBackendName] = &ExecBackend{}
+	} else {
+		t.Log("git is not installed, only testing the go-git backend")
+	}
+	return backends
+}
+
+func TestBackends(t *testing.T) {
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			remote := newTestRemote(t)
+			first := remote.commit("first")
+			second := remote.commit("second")
+
+			dir := filepath.Join(t.TempDir(), "clone")
+			if err := backend.Clone(ctx, remote.dir, dir, CloneOptions{}, io.Discard); err != nil {
+				t.Fatalf("Clone: %v", err)
+			}
+			if !backend.IsRepository(dir) {
+				t.Fatalf("IsRepository(%s) = false after cloning", dir)
+			}
+
+			assertRef := func(wantBranch, wantCommit string) {
+				t.Helper()
+				branch, commit, err := backend.CurrentRef(ctx, dir)
+				if err != nil {
+					t.Fatalf("CurrentRef: %v", err)
+				}
+				if branch != wantBranch || commit != wantCommit {
+					t.Fatalf("CurrentRef = %q, %s, want %q, %s", branch, commit, wantBranch, wantCommit)
+				}
+			}
+			assertRef("main", second)
+
+			if resolved, err := backend.ResolveRevision(ctx, dir, "main"); err != nil || resolved != second {
+				t.Errorf("ResolveRevision(main) = %s, %v, want %s", resolved, err, second)
+			}
+
+			status, err := backend.Status(ctx, dir)
+			if err != nil {
+				t.Fatalf("Status: %v", err)
+			}
+			want := WorktreeStatus{RemoteURL: remote.dir, Upstream: "origin/main"}
+			if *status != want {
+				t.Errorf("Status = %+v, want %+v", *status, want)
+			}
+
+			// A commit checks out a detached HEAD, a branch name the branch
+			if err := backend.Checkout(ctx, dir, first); err != nil {
+				t.Fatalf("Checkout(%s): %v", first, err)
+			}
+			assertRef("", first)
+			if err := backend.Checkout(ctx, dir, "main"); err != nil {
+				t.Fatalf("Checkout(main): %v", err)
+			}
+			assertRef("main", second)
+
+			// New commits of the remote are fetched, then fast-forwarded to
+			third := remote.commit("third")
+			if err := backend.Fetch(ctx, dir); err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if status, err := backend.Status(ctx, dir); err != nil || status.Behind != 1 || status.Ahead != 0 {
+				t.Errorf("Status after fetch = %+v, %v, want 1 commit behind", status, err)
+			}
+			if err := backend.FastForward(ctx, dir); err != nil {
+				t.Fatalf("FastForward: %v", err)
+			}
+			assertRef("main", third)
+
+			if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if status, err := backend.Status(ctx, dir); err != nil || status.Dirty != 1 {
+				t.Errorf("Status with an untracked file = %+v, %v, want 1 dirty file", status, err)
+			}
+		})
+	}
+}
+
+func TestBackendsFastForwardWithoutUpstream(t *testing.T) {
+	for name, backend := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			remote := newTestRemote(t)
+			remote.commit("first")
+
+			dir := filepath.Join(t.TempDir(), "clone")
+			if err := backend.Clone(ctx, remote.dir, dir, CloneOptions{}, io.Discard); err != nil {
+				t.Fatalf("Clone: %v", err)
+			}
+			local, err := git.PlainOpen(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, err := local.Head()
+			if err != nil {
+				t.Fatal(err)
+			}
+			worktree, err := local.Worktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = worktree.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("topic"), Hash: head.Hash(), Create: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := backend.FastForward(ctx, dir); !errors.Is(err, ErrNoUpstream) {
+				t.Errorf("FastForward on a branch without upstream = %v, want ErrNoUpstream", err)
+			}
+		})
+	}
+}
+
+func TestAheadBehind(t *testing.T) {
+	// Commits are written directly with the given dates, as "name:parent,parent"
+	history := []string{
+		"c1:", "c2:c1", "c3:c2",
+		"l1:c3", "l2:l1",
+		"s1:c1", "u1:c3", "u2:u1", "u3:u2,s1",
+	}
+
+	tests := []struct {
+		name                  string
+		date                  func(i int) time.Time
+		local, upstream       string
+		wantAhead, wantBehind int
+	}{
+		{name: "same commit", local: "c3", upstream: "c3"},
+		{name: "behind", local: "c2", upstream: "c3", wantBehind: 1},
+		{name: "ahead", local: "l2", upstream: "c3", wantAhead: 2},
+		{name: "diverged with a merge", local: "l2", upstream: "u3", wantAhead: 2, wantBehind: 4},
+		{name: "equal dates", date: func(int) time.Time { return time.Unix(1700000000, 0) }, local: "l2", upstream: "u3", wantAhead: 2, wantBehind: 4},
+		{name: "dates going backwards", date: func(i int) time.Time { return time.Unix(1700000000-int64(i)*60, 0) }, local: "l2", upstream: "u3", wantAhead: 2, wantBehind: 4},
+		{name: "equal dates behind", date: func(int) time.Time { return time.Unix(1700000000, 0) }, local: "c1", upstream: "c3", wantBehind: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := git.Init(memory.NewStorage(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree := storeObject(t, r, &object.Tree{})
+
+			date := tt.date
+			if date == nil {
+				date = func(i int) time.Time { return time.Unix(1700000000+int64(i)*60, 0) }
+			}
+			hashes := make(map[string]plumbing.Hash)
+			for i, spec := range history {
+				name, parentList, _ := strings.Cut(spec, ":")
+				signature := object.Signature{Name: "mess", Email: "mess@example.com", When: date(i)}
+				commit := &object.Commit{Author: signature, Committer: signature, Message: name, TreeHash: tree}
+				if parentList != "" {
+					for _, parent := range strings.Split(parentList, ",") {
+						commit.ParentHashes = append(commit.ParentHashes, hashes[parent])
+					}
+				}
+				hashes[name] = storeObject(t, r, commit)
+			}
+
+			ahead, behind, err := aheadBehind(r, hashes[tt.local], hashes[tt.upstream])
+			if err != nil {
+				t.Fatalf("aheadBehind() error = %v", err)
+			}
+			if ahead != tt.wantAhead || behind != tt.wantBehind {
+				t.Errorf("aheadBehind(%s, %s) = %d, %d, want %d, %d", tt.local, tt.upstream, ahead, behind, tt.wantAhead, tt.wantBehind)
+			}
+		})
+	}
+}
+
+// storeObject writes a tree or commit to a repository and returns its hash
+func storeObject(t *testing.T, r *git.Repository, obj interface {
+	Encode(plumbing.EncodedObject) error
+}) plumbing.Hash {
+	t.Helper()
+	encoded := r.Storer.NewEncodedObject()
+	if err := obj.Encode(encoded); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := r.Storer.SetEncodedObject(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
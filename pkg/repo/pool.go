@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"sync"
+
+	"mess/pkg/config"
+)
+
+// ForEach calls fn with the index of every repository using at most jobs
+// concurrent workers. The returned errors are indexed like repos
+func ForEach(repos []config.RepoDefinition, jobs int, fn func(i int, repo *config.RepoDefinition) error) []error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	errs := make([]error, len(repos))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < len(repos); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i, &repos[i])
+			}
+		}()
+	}
+
+	for i := range repos {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
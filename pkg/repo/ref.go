@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"mess/pkg/config"
+)
+
+// CheckRepositoryRef compares the checkout of a cloned repository with the
+// branch, ref or commit it is pinned to. It returns a human readable description
+// of the mismatch, or an empty string if the checkout matches
+func CheckRepositoryRef(repo *config.RepoDefinition, configPath string) (string, error) {
+	if repo.Revision() == "" {
+		return "", nil
+	}
+
+	ctx := context.Background()
+	repoPath := GetRepositoryPath(repo.Name, configPath)
+	branch, commit, err := Backend().CurrentRef(ctx, repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read current ref of repository %s: %v", repo.Name, err)
+	}
+
+	current := "branch '" + branch + "'"
+	if branch == "" {
+		current = "detached commit " + commit[:7]
+	}
+
+	switch {
+	case repo.Branch != "":
+		if branch == repo.Branch {
+			return "", nil
+		}
+	case repo.Commit != "":
+		if strings.HasPrefix(commit, repo.Commit) {
+			return "", nil
+		}
+	default:
+		if branch == repo.Ref {
+			return "", nil
+		}
+		resolved, err := Backend().ResolveRevision(ctx, repoPath, repo.Ref)
+		if err == nil && resolved == commit {
+			return "", nil
+		}
+	}
+
+	return fmt.Sprintf("repository '%s' is on %s but the configuration pins %s '%s'",
+		repo.Name, current, repo.RevisionKind(), repo.Revision()), nil
+}
+
+// GetRepositoryCommit returns the commit SHA checked out in a cloned repository
+func GetRepositoryCommit(repoName, configPath string) (string, error) {
+	_, commit, err := Backend().CurrentRef(context.Background(), GetRepositoryPath(repoName, configPath))
+	return commit, err
+}
+
+// CheckoutRepository checks out the branch, ref or commit a cloned repository is pinned to
+func CheckoutRepository(repo *config.RepoDefinition, configPath string) error {
+	if repo.Revision() == "" {
+		return nil
+	}
+
+	if err := Backend().Checkout(context.Background(), GetRepositoryPath(repo.Name, configPath), repo.Revision()); err != nil {
+		return fmt.Errorf("failed to check out %s %s: %v", repo.RevisionKind(), repo.Revision(), err)
+	}
+
+	return nil
+}
+
+// CheckoutLockedCommit checks out the commit a cloned repository is pinned to, as done for
+// the commits of mess.lock, if another commit is checked out. It fails rather than check out
+// over local changes
+func CheckoutLockedCommit(ctx context.Context, repo *config.RepoDefinition, configPath string, out io.Writer) error {
+	if repo.Commit == "" {
+		return nil
+	}
+
+	repoPath := GetRepositoryPath(repo.Name, configPath)
+	status := &RepositoryStatus{}
+	if err := readRepositoryStatus(ctx, repoPath, status); err != nil {
+		return err
+	}
+	if strings.HasPrefix(status.Commit, repo.Commit) {
+		return nil
+	}
+	if status.Dirty > 0 {
+		return fmt.Errorf("repository '%s' has %d dirty files, cannot check out locked commit %s", repo.Name, status.Dirty, repo.Commit)
+	}
+
+	fmt.Fprintf(out, "Checking out locked commit %s in repository '%s'...\n", repo.Commit, repo.Name)
+	if err := Backend().Checkout(ctx, repoPath, repo.Commit); err != nil {
+		return fmt.Errorf("failed to check out locked commit %s: %v", repo.Commit, err)
+	}
+	if _, commit, err := Backend().CurrentRef(ctx, repoPath); err != nil {
+		return err
+	} else if !strings.HasPrefix(commit, repo.Commit) {
+		return fmt.Errorf("repository '%s' is at %s after checking out locked commit %s", repo.Name, commit, repo.Commit)
+	}
+	return nil
+}
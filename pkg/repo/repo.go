@@ -1,9 +1,10 @@
 package repo
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 
 	"mess/pkg/config"
@@ -11,6 +12,12 @@ import (
 
 // CloneRepository clones a repository to the appropriate directory
 func CloneRepository(repo *config.RepoDefinition, configPath string) error {
+	return CloneRepositoryContext(context.Background(), repo, configPath, os.Stdout)
+}
+
+// CloneRepositoryContext clones a repository like CloneRepository, writing progress and
+// git output to out. If ctx is cancelled the clone is aborted and the partial clone removed
+func CloneRepositoryContext(ctx context.Context, repo *config.RepoDefinition, configPath string, out io.Writer) error {
 	// Get the directory containing the config file
 	configDir := filepath.Dir(configPath)
 	if configDir == "." {
@@ -32,25 +39,27 @@ func CloneRepository(repo *config.RepoDefinition, configPath string) error {
 	}
 
 	// Clone the repository
-	fmt.Printf("Cloning repository %s from %s...\n", repo.Name, repo.URL)
-	
-	// Build git clone command with optional clone_params
-	args := []string{"clone"}
-	if len(repo.CloneParams) > 0 {
-		args = append(args, repo.CloneParams...)
-	}
-	args = append(args, repo.URL, targetDir)
+	fmt.Fprintf(out, "Cloning repository %s from %s...\n", repo.Name, repo.URL)
 	
-	cmd := exec.Command("git", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
+	opts := CloneOptions{Branch: repo.Branch, Params: repo.CloneParams}
+	if err := Backend().Clone(ctx, repo.URL, targetDir, opts, out); err != nil {
 		// Clean up partially cloned directory on failure
 		os.RemoveAll(targetDir)
+		if ctx.Err() != nil {
+			return fmt.Errorf("clone of repository %s interrupted: %w", repo.Name, ctx.Err())
+		}
 		return fmt.Errorf("failed to clone repository: %v", err)
 	}
 
+	// Check out the pinned ref or commit
+	if repo.Ref != "" || repo.Commit != "" {
+		fmt.Fprintf(out, "Checking out %s %s...\n", repo.RevisionKind(), repo.Revision())
+		if err := Backend().Checkout(ctx, targetDir, repo.Revision()); err != nil {
+			os.RemoveAll(targetDir)
+			return fmt.Errorf("failed to check out %s %s: %v", repo.RevisionKind(), repo.Revision(), err)
+		}
+	}
+
 	return nil
 }
 
@@ -65,12 +74,9 @@ func IsRepositoryCloned(repoName, configPath string) bool {
 	// Target directory for the repository
 	targetDir := filepath.Join(configDir, "repos", repoName)
 
-	// Check if directory exists and contains .git directory
+	// Check if directory exists and is a git checkout
 	if stat, err := os.Stat(targetDir); err == nil && stat.IsDir() {
-		gitDir := filepath.Join(targetDir, ".git")
-		if _, err := os.Stat(gitDir); err == nil {
-			return true
-		}
+		return Backend().IsRepository(targetDir)
 	}
 
 	return false
@@ -83,4 +89,9 @@ func GetRepositoryPath(repoName, configPath string) string {
 		configDir, _ = os.Getwd()
 	}
 	return filepath.Join(configDir, "repos", repoName)
-} 
\ No newline at end of file
+} 
+
+// RunGitCommand delegates a git command line to the git backend in the directory of a cloned repository
+func RunGitCommand(ctx context.Context, repoName, configPath string, args []string) error {
+	return Backend().Run(ctx, GetRepositoryPath(repoName, configPath), args, os.Stdin, os.Stdout, os.Stderr)
+}
\ No newline at end of file
@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"strings"
+
+	"mess/pkg/config"
+)
+
+// RepositoryStatus describes the state of a repository checkout
+type RepositoryStatus struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Cloned     bool   `json:"cloned"`
+	Branch     string `json:"branch,omitempty"`
+	Commit     string `json:"commit,omitempty"`
+	Dirty      int    `json:"dirty"`
+	Upstream   string `json:"upstream,omitempty"`
+	Ahead      int    `json:"ahead"`
+	Behind     int    `json:"behind"`
+	RemoteURL  string `json:"remote_url,omitempty"`
+	URLMatches bool   `json:"url_matches"`
+	Error      string `json:"error,omitempty"`
+}
+
+// GetRepositoryStatus inspects the checkout of a repository. Failures to read
+// the state of a cloned repository are reported in the Error field
+func GetRepositoryStatus(repo *config.RepoDefinition, configPath string) *RepositoryStatus {
+	status := &RepositoryStatus{
+		Name:   repo.Name,
+		URL:    repo.URL,
+		Cloned: IsRepositoryCloned(repo.Name, configPath),
+	}
+	if !status.Cloned {
+		return status
+	}
+
+	repoPath := GetRepositoryPath(repo.Name, configPath)
+	if err := readRepositoryStatus(context.Background(), repoPath, status); err != nil {
+		status.Error = err.Error()
+	}
+
+	return status
+}
+
+// readRepositoryStatus fills the checkout related fields of a status
+func readRepositoryStatus(ctx context.Context, repoPath string, status *RepositoryStatus) error {
+	branch, commit, err := Backend().CurrentRef(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	status.Branch = branch
+	status.Commit = commit
+
+	worktree, err := Backend().Status(ctx, repoPath)
+	if err != nil {
+		return err
+	}
+	status.Dirty = worktree.Dirty
+	status.Upstream = worktree.Upstream
+	status.Ahead = worktree.Ahead
+	status.Behind = worktree.Behind
+
+	// Compare with the origin remote
+	if worktree.RemoteURL != "" {
+		status.RemoteURL = worktree.RemoteURL
+		status.URLMatches = normalizeURL(worktree.RemoteURL) == normalizeURL(status.URL)
+	}
+
+	return nil
+}
+
+// normalizeURL strips the parts of a git URL that do not change the remote it points to
+func normalizeURL(url string) string {
+	url = strings.TrimSuffix(url, "/")
+	return strings.TrimSuffix(url, ".git")
+}
@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"mess/pkg/config"
+)
+
+// SyncState describes what SyncRepository did with a repository
+type SyncState string
+
+const (
+	SyncCloned   SyncState = "cloned"
+	SyncUpdated  SyncState = "updated"
+	SyncUpToDate SyncState = "up to date"
+	SyncSkipped  SyncState = "skipped"
+	SyncFailed   SyncState = "failed"
+)
+
+// SyncResult is the outcome of synchronizing a single repository
+type SyncResult struct {
+	State  SyncState
+	Detail string
+}
+
+// SyncRepository clones a missing repository, or fetches an existing one and
+// brings it up to date: pinned commits and refs are checked out and branches are
+// fast-forwarded to their upstream. Repositories with uncommitted changes are skipped
+func SyncRepository(ctx context.Context, repo *config.RepoDefinition, configPath string, out io.Writer) SyncResult {
+	if err := ctx.Err(); err != nil {
+		return SyncResult{State: SyncSkipped, Detail: "interrupted"}
+	}
+
+	if !IsRepositoryCloned(repo.Name, configPath) {
+		if err := CloneRepositoryContext(ctx, repo, configPath, out); err != nil {
+			return SyncResult{State: SyncFailed, Detail: err.Error()}
+		}
+		return SyncResult{State: SyncCloned}
+	}
+
+	repoPath := GetRepositoryPath(repo.Name, configPath)
+
+	status := &RepositoryStatus{}
+	if err := readRepositoryStatus(ctx, repoPath, status); err != nil {
+		return SyncResult{State: SyncFailed, Detail: err.Error()}
+	}
+	if status.Dirty > 0 {
+		return SyncResult{State: SyncSkipped, Detail: fmt.Sprintf("%d dirty files", status.Dirty)}
+	}
+
+	fmt.Fprintf(out, "Fetching repository %s...\n", repo.Name)
+	if err := Backend().Fetch(ctx, repoPath); err != nil {
+		return SyncResult{State: SyncFailed, Detail: err.Error()}
+	}
+
+	// Move to the pinned commit, ref or branch first
+	if revision := repo.Revision(); revision != "" && revision != status.Branch {
+		if err := Backend().Checkout(ctx, repoPath, revision); err != nil {
+			return SyncResult{State: SyncFailed, Detail: fmt.Sprintf("failed to check out %s %s: %v", repo.RevisionKind(), revision, err)}
+		}
+	}
+
+	// Fast-forward the current branch to its upstream
+	branch, _, err := Backend().CurrentRef(ctx, repoPath)
+	if err != nil {
+		return SyncResult{State: SyncFailed, Detail: err.Error()}
+	}
+	if branch != "" {
+		if err := Backend().FastForward(ctx, repoPath); errors.Is(err, ErrNoUpstream) {
+			if repo.Revision() == "" {
+				return SyncResult{State: SyncSkipped, Detail: fmt.Sprintf("branch %s has no upstream", branch)}
+			}
+		} else if err != nil {
+			return SyncResult{State: SyncFailed, Detail: fmt.Sprintf("cannot fast-forward branch %s: %v", branch, err)}
+		}
+	} else if repo.Revision() == "" {
+		return SyncResult{State: SyncSkipped, Detail: "HEAD is detached"}
+	}
+
+	_, commit, err := Backend().CurrentRef(ctx, repoPath)
+	if err != nil {
+		return SyncResult{State: SyncFailed, Detail: err.Error()}
+	}
+	if commit == status.Commit {
+		return SyncResult{State: SyncUpToDate}
+	}
+	return SyncResult{State: SyncUpdated, Detail: fmt.Sprintf("%s..%s", status.Commit[:7], commit[:7])}
+}
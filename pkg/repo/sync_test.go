@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mess/pkg/config"
+)
+
+// useFakeBackend serves url from a new test remote through a FakeBackend for the duration
+// of a test, and returns the remote, the backend and a config path in a new project
+func useFakeBackend(t *testing.T, url string) (*testRemote, *FakeBackend, string) {
+	t.Helper()
+	remote := newTestRemote(t)
+	fake := NewFakeBackend(map[string]string{url: remote.dir})
+
+	previous := Backend()
+	SetBackend(fake)
+	t.Cleanup(func() { SetBackend(previous) })
+
+	return remote, fake, filepath.Join(t.TempDir(), "mess.json")
+}
+
+func TestSyncRepository(t *testing.T) {
+	const url = "https://example.com/app.git"
+	remote, fake, configPath := useFakeBackend(t, url)
+	first := remote.commit("first")
+	repoDef := &config.RepoDefinition{Name: "app", URL: url}
+	ctx := context.Background()
+
+	steps := []struct {
+		name   string
+		before func()
+		want   SyncState
+	}{
+		{name: "missing repository is cloned", want: SyncCloned},
+		{name: "nothing new", want: SyncUpToDate},
+		{name: "new commit is fast-forwarded", before: func() { remote.commit("second") }, want: SyncUpdated},
+		{name: "dirty checkout is skipped", before: func() {
+			if err := os.WriteFile(filepath.Join(GetRepositoryPath("app", configPath), "local.txt"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, want: SyncSkipped},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		if result := SyncRepository(ctx, repoDef, configPath, io.Discard); result.State != step.want {
+			t.Fatalf("%s: SyncRepository = %+v, want %s", step.name, result, step.want)
+		}
+	}
+
+	calls := fake.Calls()
+	if len(calls) == 0 || calls[0] != "clone "+url {
+		t.Errorf("first call = %v, want clone %s", calls, url)
+	}
+
+	// A pinned commit is checked out, detaching HEAD
+	if err := os.Remove(filepath.Join(GetRepositoryPath("app", configPath), "local.txt")); err != nil {
+		t.Fatal(err)
+	}
+	pinned := &config.RepoDefinition{Name: "app", URL: url, Commit: first}
+	if result := SyncRepository(ctx, pinned, configPath, io.Discard); result.State != SyncUpdated {
+		t.Fatalf("SyncRepository with a pinned commit = %+v, want %s", result, SyncUpdated)
+	}
+	if commit, err := GetRepositoryCommit("app", configPath); err != nil || commit != first {
+		t.Errorf("commit after sync = %s, %v, want %s", commit, err, first)
+	}
+}
+
+func TestSyncRepositoryInterrupted(t *testing.T) {
+	const url = "https://example.com/app.git"
+	remote, fake, configPath := useFakeBackend(t, url)
+	remote.commit("first")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result := SyncRepository(ctx, &config.RepoDefinition{Name: "app", URL: url}, configPath, io.Discard)
+	if result.State != SyncSkipped || len(fake.Calls()) != 0 {
+		t.Errorf("SyncRepository after cancel = %+v with calls %v, want skipped without calls", result, fake.Calls())
+	}
+}
+
+func TestGetRepositoryStatus(t *testing.T) {
+	const url = "https://example.com/app.git"
+	remote, _, configPath := useFakeBackend(t, url)
+	commit := remote.commit("first")
+
+	repoDef := &config.RepoDefinition{Name: "app", URL: url}
+	if status := GetRepositoryStatus(repoDef, configPath); status.Cloned {
+		t.Fatalf("status before cloning = %+v, want not cloned", status)
+	}
+	if err := CloneRepositoryContext(context.Background(), repoDef, configPath, io.Discard); err != nil {
+		t.Fatalf("CloneRepositoryContext: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+		want RepositoryStatus
+	}{
+		{
+			name: "matching URL",
+			url:  url,
+			want: RepositoryStatus{Name: "app", URL: url, Cloned: true, Branch: "main", Commit: commit,
+				Upstream: "origin/main", RemoteURL: url, URLMatches: true},
+		},
+		{
+			name: "URL differing only by .git",
+			url:  strings.TrimSuffix(url, ".git"),
+			want: RepositoryStatus{Name: "app", URL: strings.TrimSuffix(url, ".git"), Cloned: true, Branch: "main", Commit: commit,
+				Upstream: "origin/main", RemoteURL: url, URLMatches: true},
+		},
+		{
+			name: "other URL",
+			url:  "https://example.com/other.git",
+			want: RepositoryStatus{Name: "app", URL: "https://example.com/other.git", Cloned: true, Branch: "main", Commit: commit,
+				Upstream: "origin/main", RemoteURL: url},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := GetRepositoryStatus(&config.RepoDefinition{Name: "app", URL: test.url}, configPath)
+			if *status != test.want {
+				t.Errorf("GetRepositoryStatus = %+v, want %+v", *status, test.want)
+			}
+		})
+	}
+}